@@ -0,0 +1,125 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	crdutil "github.com/crdsdev/doc/pkg/crd"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	"sigs.k8s.io/yaml"
+)
+
+// maxManifestSize is the maximum size of a manifest that may be submitted.
+const maxManifestSize = 1 << 20
+
+type defaultData struct {
+	Page      pageData
+	Repo      string
+	Tag       string
+	Group     string
+	Version   string
+	Kind      string
+	Manifest  string
+	Defaulted string
+	Invalid   []*crdutil.FieldError
+	Warnings  []string
+	Pruned    []crdutil.PrunedField
+	Error     string
+}
+
+// defaultInstance renders a form that shows a submitted manifest with the
+// defaults from its CRD's schema applied, along with any validation errors and
+// the fields that would be pruned.
+func defaultInstance(w http.ResponseWriter, r *http.Request) {
+	org, repo, group, kind, version, tag, err := parseGHURL(strings.TrimPrefix(r.URL.Path, "/default"))
+	if err != nil {
+		log.Printf("failed to parse Github path: %v", err)
+		fmt.Fprint(w, "Invalid URL.")
+		return
+	}
+	pageData := getPageData(r, fmt.Sprintf("%s.%s/%s", kind, group, version), false)
+	crd := &apiextensions.CustomResourceDefinition{}
+	stored, err := getCRD(crd, org, repo, group, version, kind, tag)
+	if err != nil {
+		log.Printf("failed to get CRD for %s : %v", repo, err)
+		fmt.Fprint(w, "Unable to find CRD.")
+		return
+	}
+	data := defaultData{
+		Page:    pageData,
+		Repo:    strings.Join([]string{org, repo}, "/"),
+		Tag:     stored.Tag,
+		Group:   group,
+		Version: version,
+		Kind:    kind,
+	}
+	if gvk := crdutil.GetStoredGVK(crd); gvk != nil {
+		data.Manifest = fmt.Sprintf("apiVersion: %s/%s\nkind: %s\nmetadata:\n  name: example\n", gvk.Group, gvk.Version, gvk.Kind)
+	}
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxManifestSize)
+		data.Manifest = r.FormValue("manifest")
+		checkManifest(crd, stored.Deprecated, &data)
+	}
+	if err := page.HTML(w, http.StatusOK, "default", data); err != nil {
+		log.Printf("defaultTemplate.Execute(): %v", err)
+		fmt.Fprint(w, "Unable to render default template.")
+		return
+	}
+	log.Printf("successfully rendered default template")
+}
+
+func checkManifest(crd *apiextensions.CustomResourceDefinition, deprecated map[string]string, data *defaultData) {
+	gvk := crdutil.GetStoredGVK(crd)
+	if gvk == nil {
+		data.Error = "Supplied CRD has no GVK."
+		return
+	}
+	crder := &crdutil.CRDer{CRD: crd, GVK: gvk, Deprecated: deprecated}
+	manifest := []byte(data.Manifest)
+	obj, err := crder.Default(manifest)
+	if err != nil {
+		data.Error = err.Error()
+		return
+	}
+	y, err := yaml.Marshal(obj)
+	if err != nil {
+		data.Error = err.Error()
+		return
+	}
+	data.Defaulted = string(y)
+	if data.Warnings, err = crder.DeprecationWarnings(manifest); err != nil {
+		data.Error = err.Error()
+		return
+	}
+	err = crder.Validate(manifest)
+	var verr *crdutil.ValidationError
+	if errors.As(err, &verr) {
+		data.Invalid = verr.Errors
+	} else if err != nil {
+		data.Error = err.Error()
+		return
+	}
+	if data.Pruned, err = crder.Prune(manifest); err != nil {
+		data.Error = err.Error()
+	}
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	crdutil "github.com/crdsdev/doc/pkg/crd"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+// explain serves a plain text description of a field of a CRD in the format
+// of kubectl explain. The field is selected with the path query parameter,
+// such as spec.containers[].resources, and defaults to the whole resource.
+func explain(w http.ResponseWriter, r *http.Request) {
+	org, repo, group, kind, version, tag, err := parseGHURL(strings.TrimPrefix(r.URL.Path, "/explain"))
+	if err != nil {
+		log.Printf("failed to parse Github path: %v", err)
+		http.Error(w, "Invalid URL.", http.StatusBadRequest)
+		return
+	}
+	crd := &apiextensions.CustomResourceDefinition{}
+	if _, err := getCRD(crd, org, repo, group, version, kind, tag); err != nil {
+		log.Printf("failed to get CRD for %s : %v", repo, err)
+		http.Error(w, "Unable to find CRD.", http.StatusNotFound)
+		return
+	}
+	text, err := (&crdutil.CRDer{CRD: crd}).Explain(version, r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to explain field: %v", err), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, text)
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	crdutil "github.com/crdsdev/doc/pkg/crd"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var goPackageReg = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+// goTypes serves Go types for a CRD as a file download. The package name
+// defaults to the version of the CRD and may be set with the package query
+// parameter.
+func goTypes(w http.ResponseWriter, r *http.Request) {
+	org, repo, group, kind, version, tag, err := parseGHURL(strings.TrimPrefix(r.URL.Path, "/gotypes"))
+	if err != nil {
+		log.Printf("failed to parse Github path: %v", err)
+		http.Error(w, "Invalid URL.", http.StatusBadRequest)
+		return
+	}
+	pkg := r.URL.Query().Get("package")
+	if pkg == "" {
+		pkg = strings.ToLower(version)
+	}
+	if !goPackageReg.MatchString(pkg) {
+		http.Error(w, "Invalid package name.", http.StatusBadRequest)
+		return
+	}
+	crd := &apiextensions.CustomResourceDefinition{}
+	if _, err := getCRD(crd, org, repo, group, version, kind, tag); err != nil {
+		log.Printf("failed to get CRD for %s : %v", repo, err)
+		http.Error(w, "Unable to find CRD.", http.StatusNotFound)
+		return
+	}
+	gvk := &schema.GroupVersionKind{Group: crd.Spec.Group, Version: version, Kind: crd.Spec.Names.Kind}
+	src, err := (&crdutil.CRDer{CRD: crd, GVK: gvk}).GoTypes(pkg)
+	if err != nil {
+		log.Printf("failed to generate Go types for %s : %v", repo, err)
+		http.Error(w, fmt.Sprintf("Unable to generate Go types: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", strings.ToLower(kind)+"_types.go"))
+	w.Write(src)
+	log.Printf("successfully rendered Go types")
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	crdutil "github.com/crdsdev/doc/pkg/crd"
+	"github.com/gorilla/mux"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+// schemaLocation is the kubeconform schema location template for the JSON
+// Schema catalog of a repo at a tag.
+const schemaLocation = "%s/jsonschema/github.com/%s@%s/{{ .Group }}/{{ .ResourceKind }}_{{ .ResourceAPIVersion }}.json"
+
+// jsonSchemaCatalog lists the JSON Schema files served for a repo at a tag.
+type jsonSchemaCatalog struct {
+	Repo           string   `json:"repo"`
+	Tag            string   `json:"tag"`
+	SchemaLocation string   `json:"schemaLocation"`
+	Schemas        []string `json:"schemas"`
+}
+
+// jsonSchemaIndex lists the JSON Schema files for the served versions of the
+// CRDs in a repo at a tag. Files are named {group}/{kind}_{version}.json with
+// the kind in lower case, as expected by kubeconform.
+func jsonSchemaIndex(w http.ResponseWriter, r *http.Request) {
+	parameters := mux.Vars(r)
+	org := parameters["org"]
+	repo := parameters["repo"]
+	tag := parameters["tag"]
+	fullRepo := fmt.Sprintf("%s/%s/%s", "github.com", org, repo)
+
+	foundTag, crds, err := getRepoCRDs(fullRepo, tag)
+	if err != nil {
+		log.Printf("failed to get CRDs for %s : %v", repo, err)
+		http.Error(w, "Unable to get CRDs.", http.StatusInternalServerError)
+		return
+	}
+	if len(crds) == 0 {
+		http.Error(w, "Unable to find CRDs for this repo and tag.", http.StatusNotFound)
+		return
+	}
+	c := jsonSchemaCatalog{
+		Repo:    strings.Join([]string{org, repo}, "/"),
+		Tag:     foundTag,
+		Schemas: []string{},
+	}
+	c.SchemaLocation = fmt.Sprintf(schemaLocation, baseURL(r), c.Repo, c.Tag)
+	for _, crd := range crds {
+		for _, v := range crd.Spec.Versions {
+			if v.Served {
+				c.Schemas = append(c.Schemas, jsonSchemaFile(crd, v.Name))
+			}
+		}
+	}
+	sort.Strings(c.Schemas)
+	if err := page.JSON(w, http.StatusOK, c); err != nil {
+		log.Printf("failed to render JSON Schema catalog: %v", err)
+	}
+}
+
+// jsonSchema serves the JSON Schema for a version of a CRD in a repo at a
+// tag. Unknown properties are rejected if the strict query parameter is true.
+func jsonSchema(w http.ResponseWriter, r *http.Request) {
+	parameters := mux.Vars(r)
+	org := parameters["org"]
+	repo := parameters["repo"]
+	tag := parameters["tag"]
+	group := parameters["group"]
+	file := strings.TrimSuffix(parameters["file"], ".json")
+	fullRepo := fmt.Sprintf("%s/%s/%s", "github.com", org, repo)
+
+	i := strings.LastIndex(file, "_")
+	if i < 0 {
+		http.Error(w, "Invalid schema file name.", http.StatusBadRequest)
+		return
+	}
+	kind, version := file[:i], file[i+1:]
+
+	_, crds, err := getRepoCRDs(fullRepo, tag)
+	if err != nil {
+		log.Printf("failed to get CRDs for %s : %v", repo, err)
+		http.Error(w, "Unable to get CRDs.", http.StatusInternalServerError)
+		return
+	}
+	for _, crd := range crds {
+		if crd.Spec.Group != group || !strings.EqualFold(crd.Spec.Names.Kind, kind) {
+			continue
+		}
+		s, err := (&crdutil.CRDer{CRD: crd}).JSONSchema(version, r.URL.Query().Get("strict") == "true")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Unable to convert schema: %v", err), http.StatusNotFound)
+			return
+		}
+		if err := page.JSON(w, http.StatusOK, s); err != nil {
+			log.Printf("failed to render JSON Schema: %v", err)
+		}
+		return
+	}
+	http.Error(w, "Unable to find CRD.", http.StatusNotFound)
+}
+
+func jsonSchemaFile(crd *apiextensions.CustomResourceDefinition, version string) string {
+	return fmt.Sprintf("%s/%s_%s.json", crd.Spec.Group, strings.ToLower(crd.Spec.Names.Kind), version)
+}
+
+// baseURL returns the scheme and host that the request was made to.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if p := r.Header.Get("X-Forwarded-Proto"); p != "" {
+		scheme = p
+	}
+	return scheme + "://" + r.Host
+}
@@ -17,23 +17,24 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
-	"net/rpc"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	crdutil "github.com/crdsdev/doc/pkg/crd"
 	"github.com/crdsdev/doc/pkg/models"
+	"github.com/crdsdev/doc/pkg/store"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"github.com/jackc/pgx/v4"
-	"github.com/jackc/pgx/v4/pgxpool"
 	flag "github.com/spf13/pflag"
 	"github.com/unrolled/render"
 	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
@@ -41,7 +42,7 @@ import (
 	"sigs.k8s.io/yaml"
 )
 
-var db *pgxpool.Pool
+var db store.Store
 
 // redis connection
 var (
@@ -59,7 +60,20 @@ var (
 	address   string
 	analytics bool = false
 
-	gitterChan chan models.GitterRepo
+	queueSize       = flag.Int("index-queue-size", 4, "Maximum number of repos waiting to be indexed.")
+	globalIndexRate = flag.Int("index-rate", 30, "Maximum number of repos queued for indexing per minute.")
+	clientIndexRate = flag.Int("index-client-rate", 5, "Maximum number of repos queued for indexing per minute by a single client.")
+	indexDenylist   = flag.StringSlice("index-denylist", nil, "Orgs or org/repos that will not be indexed.")
+	indexTimeout    = flag.Duration("index-timeout", 15*time.Minute, "Maximum time to spend indexing a single repo, including retries.")
+	indexAttempts   = flag.Int("index-attempts", 5, "Maximum number of attempts to index a repo when gitter cannot be reached.")
+	gitterURL       = flag.String("gitter-url", "http://127.0.0.1:1234", "URL of the gitter API.")
+	gitterCert      = flag.String("gitter-tls-cert", "", "Client certificate file presented to gitter.")
+	gitterKey       = flag.String("gitter-tls-key", "", "Client key file presented to gitter.")
+	gitterCA        = flag.String("gitter-tls-ca", "", "CA file used to verify gitter's certificate.")
+	sqlitePath      = flag.String("sqlite", "", "Path of a SQLite database to use instead of Postgres.")
+	refreshInterval = flag.Duration("refresh-interval", 0, "Queue a reindex of all tags of a repo when its page is viewed and its last index was attempted longer ago than this. Zero disables refreshing.")
+
+	queue *indexQueue
 )
 
 // SchemaPlusParent is a JSON schema plus the name of the parent field.
@@ -97,52 +111,73 @@ type baseData struct {
 }
 
 type docData struct {
-	Page        pageData
-	Repo        string
-	Tag         string
-	At          string
-	Group       string
-	Version     string
-	Kind        string
-	Description string
-	Schema      apiextensions.JSONSchemaProps
+	Page           pageData
+	Repo           string
+	Tag            string
+	At             string
+	Group          string
+	Version        string
+	Kind           string
+	Description    string
+	Schema         apiextensions.JSONSchemaProps
+	Conversion     *apiextensions.CustomResourceConversion
+	Scope          string
+	Names          apiextensions.CustomResourceDefinitionNames
+	PrinterColumns []apiextensions.CustomResourceColumnDefinition
+	Subresources   *apiextensions.CustomResourceSubresources
+	Warnings       []*crdutil.FieldError
+	NonStructural  []*crdutil.FieldError
+	Compatibility  []crdutil.Compat
 }
 
-type orgData struct {
-	Page  pageData
-	Repo  string
-	Tag   string
-	At    string
-	Tags  []string
-	CRDs  map[string]models.RepoCRD
-	Total int
+// docJSON is the JSON output of the doc page. The CRD fields use their v1
+// form, as they are written in manifests.
+type docJSON struct {
+	Repo                     string                              `json:"repo"`
+	Tag                      string                              `json:"tag"`
+	Group                    string                              `json:"group"`
+	Version                  string                              `json:"version"`
+	Kind                     string                              `json:"kind"`
+	Scope                    string                              `json:"scope"`
+	Names                    v1.CustomResourceDefinitionNames    `json:"names"`
+	AdditionalPrinterColumns []v1.CustomResourceColumnDefinition `json:"additionalPrinterColumns,omitempty"`
+	Subresources             *v1.CustomResourceSubresources      `json:"subresources,omitempty"`
+	Conversion               *v1.CustomResourceConversion        `json:"conversion,omitempty"`
+	Schema                   v1.JSONSchemaProps                  `json:"schema"`
+	Warnings                 []*crdutil.FieldError               `json:"warnings,omitempty"`
+	NonStructural            []*crdutil.FieldError               `json:"nonStructural,omitempty"`
+	Compatibility            []crdutil.Compat                    `json:"compatibility"`
 }
 
-type homeData struct {
-	Page  pageData
-	Repos []string
+type orgData struct {
+	Page          pageData
+	Repo          string
+	Tag           string
+	At            string
+	Tags          []string
+	CRDs          map[string]models.RepoCRD
+	NonStructural map[string]bool
+	// Changed holds the CRDs that are new or differ in Previous, the tag
+	// before Tag.
+	Previous string
+	Changed  map[string]bool
+	// Info is the metadata and index record of the repo, or nil. It is only
+	// rendered by the template, as its description is untrusted text.
+	Info          *models.Repo `json:"-"`
+	KubeVersions  []string
+	Compatibility map[string][]crdutil.Compat
+	Total         int
 }
 
-func worker(gitterChan <-chan models.GitterRepo) {
-	for job := range gitterChan {
-		client, err := rpc.DialHTTP("tcp", "127.0.0.1:1234")
-		if err != nil {
-			log.Fatal("dialing:", err)
-		}
-		reply := ""
-		if err := client.Call("Gitter.Index", job, &reply); err != nil {
-			log.Print("Could not index repo")
-		}
-	}
+type newData struct {
+	Page    pageData
+	Message string
+	Error   string
 }
 
-func tryIndex(repo models.GitterRepo, gitterChan chan models.GitterRepo) bool {
-	select {
-	case gitterChan <- repo:
-		return true
-	default:
-		return false
-	}
+type homeData struct {
+	Page  pageData
+	Repos []string
 }
 
 func init() {
@@ -151,24 +186,35 @@ func init() {
 	if analyticsStr == "true" {
 		analytics = true
 	}
-
-	gitterChan = make(chan models.GitterRepo, 4)
 }
 
 func main() {
 	flag.Parse()
-	dsn := fmt.Sprintf("postgresql://%s:%s@%s:%s/%s", os.Getenv(userEnv), os.Getenv(passwordEnv), os.Getenv(hostEnv), os.Getenv(portEnv), os.Getenv(dbEnv))
-	conn, err := pgxpool.ParseConfig(dsn)
+	var err error
+	if *sqlitePath != "" {
+		db, err = store.NewSQLite(*sqlitePath)
+	} else {
+		dsn := fmt.Sprintf("postgresql://%s:%s@%s:%s/%s", os.Getenv(userEnv), os.Getenv(passwordEnv), os.Getenv(hostEnv), os.Getenv(portEnv), os.Getenv(dbEnv))
+		db, err = store.NewPostgres(context.Background(), dsn)
+	}
 	if err != nil {
 		panic(err)
 	}
-	db, err = pgxpool.ConnectConfig(context.Background(), conn)
+	steps, err := db.Migrator().Up(context.Background())
+	for _, s := range steps {
+		log.Printf("Applied migration %s", s)
+	}
 	if err != nil {
 		panic(err)
 	}
 
+	gc, err := newGitterClient()
+	if err != nil {
+		panic(err)
+	}
+	queue = newIndexQueue(*queueSize, *globalIndexRate, *clientIndexRate, *indexDenylist)
 	for i := 0; i < 4; i++ {
-		go worker(gitterChan)
+		go worker(gc, queue)
 	}
 
 	start()
@@ -197,6 +243,15 @@ func start() {
 	r.HandleFunc("/github.com/{org}/{repo}", org)
 	r.HandleFunc("/raw/github.com/{org}/{repo}@{tag}", raw)
 	r.HandleFunc("/raw/github.com/{org}/{repo}", raw)
+	r.HandleFunc("/scorecard/github.com/{org}/{repo}@{tag}", repoScorecard)
+	r.HandleFunc("/scorecard/github.com/{org}/{repo}", repoScorecard)
+	r.HandleFunc("/jsonschema/github.com/{org}/{repo}@{tag}", jsonSchemaIndex)
+	r.HandleFunc("/jsonschema/github.com/{org}/{repo}", jsonSchemaIndex)
+	r.HandleFunc("/jsonschema/github.com/{org}/{repo}@{tag}/{group}/{file}", jsonSchema)
+	r.HandleFunc("/jsonschema/github.com/{org}/{repo}/{group}/{file}", jsonSchema)
+	r.PathPrefix("/default/").HandlerFunc(defaultInstance)
+	r.PathPrefix("/gotypes/").HandlerFunc(goTypes)
+	r.PathPrefix("/explain/").HandlerFunc(explain)
 	r.PathPrefix("/").HandlerFunc(doc)
 	log.Fatal(http.ListenAndServe(":5000", r))
 }
@@ -217,30 +272,38 @@ func raw(w http.ResponseWriter, r *http.Request) {
 	repo := parameters["repo"]
 	tag := parameters["tag"]
 
+	upgrade := r.URL.Query().Get("upgrade") == "true"
+
 	fullRepo := fmt.Sprintf("%s/%s/%s", "github.com", org, repo)
-	var rows pgx.Rows
-	var err error
-	if tag == "" {
-		rows, err = db.Query(context.Background(), "SELECT c.data::jsonb FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.id = (SELECT id FROM tags WHERE LOWER(repo) = LOWER($1) ORDER BY time DESC LIMIT 1);", fullRepo)
-	} else {
-		rows, err = db.Query(context.Background(), "SELECT c.data::jsonb FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.name=$2;", fullRepo, tag)
-	}
+	_, crds, err := db.CRDs(context.Background(), fullRepo, tag)
 
-	var res []byte
 	var total []byte
-	for err == nil && rows.Next() {
-		if err := rows.Scan(&res); err != nil {
-			break
-		}
+	for _, c := range crds {
 		crd := &apiextensions.CustomResourceDefinition{}
-		if err := yaml.Unmarshal(res, crd); err != nil {
+		if err := yaml.Unmarshal(c.CRD, crd); err != nil {
 			break
 		}
 		crdv1 := &v1.CustomResourceDefinition{}
-		if err := v1.Convert_apiextensions_CustomResourceDefinition_To_v1_CustomResourceDefinition(crd, crdv1, nil); err != nil {
-			break
+		if upgrade {
+			var fixes []crdutil.Fix
+			var verr error
+			if crdv1, fixes, verr = crdutil.UpgradeToV1(crd); crdv1 == nil {
+				err = verr
+				break
+			}
+			total = append(total, upgradeComment(fixes, verr)...)
+		} else {
+			// Stored webhooks have no client config, without which the
+			// manifest could not be applied, so None is written instead.
+			if noWebhook, ok := crdutil.WithoutRedactedWebhook(crd); ok {
+				crd = noWebhook
+				total = append(total, []byte("# spec.conversion.strategy was set to None, as the client config of the conversion webhook is not published.\n")...)
+			}
+			if err := v1.Convert_apiextensions_CustomResourceDefinition_To_v1_CustomResourceDefinition(crd, crdv1, nil); err != nil {
+				break
+			}
+			crdv1.SetGroupVersionKind(v1.SchemeGroupVersion.WithKind("CustomResourceDefinition"))
 		}
-		crdv1.SetGroupVersionKind(v1.SchemeGroupVersion.WithKind("CustomResourceDefinition"))
 		y, err := yaml.Marshal(crdv1)
 		if err != nil {
 			break
@@ -290,17 +353,10 @@ func org(w http.ResponseWriter, r *http.Request) {
 	tag := parameters["tag"]
 	pageData := getPageData(r, fmt.Sprintf("%s/%s", org, repo), false)
 	fullRepo := fmt.Sprintf("%s/%s/%s", "github.com", org, repo)
-	b := &pgx.Batch{}
-	if tag == "" {
-		b.Queue("SELECT t.name, c.group, c.version, c.kind FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.id = (SELECT id FROM tags WHERE LOWER(repo) = LOWER($1) ORDER BY time DESC LIMIT 1);", fullRepo)
-	} else {
+	if tag != "" {
 		pageData.Title += fmt.Sprintf("@%s", tag)
-		b.Queue("SELECT t.name, c.group, c.version, c.kind FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.name=$2;", fullRepo, tag)
 	}
-	b.Queue("SELECT name FROM tags WHERE LOWER(repo)=LOWER($1) ORDER BY time DESC;", fullRepo)
-	br := db.SendBatch(context.Background(), b)
-	defer br.Close()
-	c, err := br.Query()
+	foundTag, crds, err := db.CRDs(context.Background(), fullRepo, tag)
 	if err != nil {
 		log.Printf("failed to get CRDs for %s : %v", repo, err)
 		if err := page.HTML(w, http.StatusOK, "new", baseData{Page: pageData}); err != nil {
@@ -310,21 +366,27 @@ func org(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	repoCRDs := map[string]models.RepoCRD{}
-	foundTag := tag
-	for c.Next() {
-		var t, g, v, k string
-		if err := c.Scan(&t, &g, &v, &k); err != nil {
-			log.Printf("newTemplate.Execute(): %v", err)
-			fmt.Fprint(w, "Unable to render new template.")
+	nonStructural := map[string]bool{}
+	compat := map[string][]crdutil.Compat{}
+	for _, c := range crds {
+		crd := &apiextensions.CustomResourceDefinition{}
+		var deprecated map[string]string
+		if err := decodeCRD(c, crd, nil, &deprecated); err != nil {
+			log.Printf("failed to decode CRD %s/%s/%s: %v", c.Group, c.Version, c.Kind, err)
+			continue
+		}
+		key := c.Group + "/" + c.Version + "/" + c.Kind
+		repoCRDs[key] = models.RepoCRD{
+			Group:   c.Group,
+			Version: c.Version,
+			Kind:    c.Kind,
 		}
-		foundTag = t
-		repoCRDs[g+"/"+v+"/"+k] = models.RepoCRD{
-			Group:   g,
-			Version: v,
-			Kind:    k,
+		if crdutil.NonStructural(crd) != nil {
+			nonStructural[key] = true
 		}
+		compat[key] = crdutil.Compatibility(crd, deprecated)
 	}
-	c, err = br.Query()
+	tags, err := db.Tags(context.Background(), fullRepo)
 	if err != nil {
 		log.Printf("failed to get tags for %s : %v", repo, err)
 		if err := page.HTML(w, http.StatusOK, "new", baseData{Page: pageData}); err != nil {
@@ -333,26 +395,33 @@ func org(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	tags := []string{}
 	tagExists := false
-	for c.Next() {
-		var t string
-		if err := c.Scan(&t); err != nil {
-			log.Printf("newTemplate.Execute(): %v", err)
-			fmt.Fprint(w, "Unable to render new template.")
-		}
-		if !tagExists && t == tag {
+	for _, t := range tags {
+		if t == tag {
 			tagExists = true
+			break
 		}
-		tags = append(tags, t)
 	}
 	if len(tags) == 0 || (!tagExists && tag != "") {
-		tryIndex(models.GitterRepo{
+		job := models.GitterRepo{
 			Org:  org,
 			Repo: repo,
 			Tag:  tag,
-		}, gitterChan)
-		if err := page.HTML(w, http.StatusOK, "new", baseData{Page: pageData}); err != nil {
+		}
+		prev, hasPrev := queue.status(job)
+		res := queue.enqueue(job, clientID(r))
+		status := http.StatusOK
+		if res == rateLimited {
+			status = http.StatusTooManyRequests
+		}
+		data := newData{Page: pageData, Message: res.message()}
+		if hasPrev && prev.State == jobFailed {
+			data.Error = prev.Error
+		}
+		if s, ok := queue.status(job); ok && s.State == jobRunning && s.Attempts > 1 {
+			data.Message = fmt.Sprintf("We are having trouble indexing this version of this repo (attempt %d). Check back shortly.", s.Attempts)
+		}
+		if err := page.HTML(w, status, "new", data); err != nil {
 			log.Printf("newTemplate.Execute(): %v", err)
 			fmt.Fprint(w, "Unable to render new template.")
 		}
@@ -361,13 +430,27 @@ func org(w http.ResponseWriter, r *http.Request) {
 	if foundTag == "" {
 		foundTag = tags[0]
 	}
+	previous, changed := changedSince(fullRepo, foundTag, tags, crds)
+	info, err := db.Repo(context.Background(), fullRepo)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("failed to get repo %s: %v", fullRepo, err)
+	}
+	if info != nil && *refreshInterval > 0 && info.NeedsRefresh(*refreshInterval, time.Now()) {
+		queue.enqueue(models.GitterRepo{Org: org, Repo: repo}, refreshClientID)
+	}
 	if err := page.HTML(w, http.StatusOK, "org", orgData{
-		Page:  pageData,
-		Repo:  strings.Join([]string{org, repo}, "/"),
-		Tag:   foundTag,
-		Tags:  tags,
-		CRDs:  repoCRDs,
-		Total: len(repoCRDs),
+		Page:          pageData,
+		Repo:          strings.Join([]string{org, repo}, "/"),
+		Tag:           foundTag,
+		Tags:          tags,
+		CRDs:          repoCRDs,
+		NonStructural: nonStructural,
+		Previous:      previous,
+		Changed:       changed,
+		Info:          info,
+		KubeVersions:  kubeVersionNames(),
+		Compatibility: compat,
+		Total:         len(repoCRDs),
 	}); err != nil {
 		log.Printf("orgTemplate.Execute(): %v", err)
 		fmt.Fprint(w, "Unable to render org template.")
@@ -376,6 +459,38 @@ func org(w http.ResponseWriter, r *http.Request) {
 	log.Printf("successfully rendered org template")
 }
 
+// changedSince returns the tag before tag, and the CRDs of tag that are new or
+// whose data differs in it. Only the hashes of the previous CRDs are read.
+func changedSince(fullRepo, tag string, tags []string, crds []models.RepoCRD) (string, map[string]bool) {
+	previous := ""
+	for i, t := range tags {
+		if t == tag && i+1 < len(tags) {
+			previous = tags[i+1]
+			break
+		}
+	}
+	if previous == "" {
+		return "", nil
+	}
+	_, prevCRDs, err := db.CRDHashes(context.Background(), fullRepo, previous)
+	if err != nil {
+		log.Printf("failed to get CRD hashes for %s@%s: %v", fullRepo, previous, err)
+		return "", nil
+	}
+	hashes := map[string]string{}
+	for _, c := range prevCRDs {
+		hashes[c.Group+"/"+c.Version+"/"+c.Kind] = c.Hash
+	}
+	changed := map[string]bool{}
+	for _, c := range crds {
+		key := c.Group + "/" + c.Version + "/" + c.Kind
+		if hashes[key] != c.Hash {
+			changed[key] = true
+		}
+	}
+	return previous, changed
+}
+
 func doc(w http.ResponseWriter, r *http.Request) {
 	var schema *apiextensions.CustomResourceValidation
 	crd := &apiextensions.CustomResourceDefinition{}
@@ -387,15 +502,8 @@ func doc(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	pageData := getPageData(r, fmt.Sprintf("%s.%s/%s", kind, group, version), false)
-	fullRepo := fmt.Sprintf("%s/%s/%s", "github.com", org, repo)
-	var c pgx.Row
-	if tag == "" {
-		c = db.QueryRow(context.Background(), "SELECT t.name, c.data::jsonb FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.id = (SELECT id FROM tags WHERE repo = $1 ORDER BY time DESC LIMIT 1) AND c.group=$2 AND c.version=$3 AND c.kind=$4;", fullRepo, group, version, kind)
-	} else {
-		c = db.QueryRow(context.Background(), "SELECT t.name, c.data::jsonb FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.name=$2 AND c.group=$3 AND c.version=$4 AND c.kind=$5;", fullRepo, tag, group, version, kind)
-	}
-	foundTag := tag
-	if err := c.Scan(&foundTag, crd); err != nil {
+	stored, err := getCRD(crd, org, repo, group, version, kind, tag)
+	if err != nil {
 		log.Printf("failed to get CRDs for %s : %v", repo, err)
 		if err := page.HTML(w, http.StatusOK, "doc", baseData{Page: pageData}); err != nil {
 			log.Printf("newTemplate.Execute(): %v", err)
@@ -427,16 +535,41 @@ func doc(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := page.HTML(w, http.StatusOK, "doc", docData{
-		Page:        pageData,
-		Repo:        strings.Join([]string{org, repo}, "/"),
-		Tag:         foundTag,
-		Group:       gvk.Group,
-		Version:     gvk.Version,
-		Kind:        gvk.Kind,
-		Description: string(schema.OpenAPIV3Schema.Description),
-		Schema:      *schema.OpenAPIV3Schema,
-	}); err != nil {
+	data := docData{
+		Page:           pageData,
+		Repo:           strings.Join([]string{org, repo}, "/"),
+		Tag:            stored.Tag,
+		Group:          gvk.Group,
+		Version:        gvk.Version,
+		Kind:           gvk.Kind,
+		Description:    string(schema.OpenAPIV3Schema.Description),
+		Schema:         *schema.OpenAPIV3Schema,
+		Conversion:     crd.Spec.Conversion,
+		Scope:          string(crd.Spec.Scope),
+		Names:          crd.Spec.Names,
+		PrinterColumns: crdutil.GetVersionPrinterColumns(crd, gvk.Version),
+		Subresources:   crdutil.GetVersionSubresources(crd, gvk.Version),
+		Warnings:       stored.Warnings,
+	}
+	var verr *crdutil.ValidationError
+	if errors.As(crdutil.NonStructural(crd), &verr) {
+		data.NonStructural = verr.Errors
+	}
+	data.Compatibility = crdutil.Compatibility(crd, stored.Deprecated)
+	if r.URL.Query().Get("format") == "json" {
+		j, err := newDocJSON(data)
+		if err != nil {
+			log.Printf("failed to convert CRD to v1: %v", err)
+			http.Error(w, "Unable to render CRD.", http.StatusInternalServerError)
+			return
+		}
+		if err := page.JSON(w, http.StatusOK, j); err != nil {
+			log.Printf("failed to render doc JSON: %v", err)
+		}
+		return
+	}
+
+	if err := page.HTML(w, http.StatusOK, "doc", data); err != nil {
 		log.Printf("docTemplate.Execute(): %v", err)
 		fmt.Fprint(w, "Supplied CRD has no schema.")
 		return
@@ -444,6 +577,146 @@ func doc(w http.ResponseWriter, r *http.Request) {
 	log.Printf("successfully rendered doc template")
 }
 
+func newDocJSON(d docData) (*docJSON, error) {
+	j := &docJSON{
+		Repo:          d.Repo,
+		Tag:           d.Tag,
+		Group:         d.Group,
+		Version:       d.Version,
+		Kind:          d.Kind,
+		Scope:         d.Scope,
+		Warnings:      d.Warnings,
+		NonStructural: d.NonStructural,
+		Compatibility: d.Compatibility,
+	}
+	if err := v1.Convert_apiextensions_CustomResourceDefinitionNames_To_v1_CustomResourceDefinitionNames(&d.Names, &j.Names, nil); err != nil {
+		return nil, err
+	}
+	for i := range d.PrinterColumns {
+		c := v1.CustomResourceColumnDefinition{}
+		if err := v1.Convert_apiextensions_CustomResourceColumnDefinition_To_v1_CustomResourceColumnDefinition(&d.PrinterColumns[i], &c, nil); err != nil {
+			return nil, err
+		}
+		j.AdditionalPrinterColumns = append(j.AdditionalPrinterColumns, c)
+	}
+	if d.Subresources != nil {
+		j.Subresources = &v1.CustomResourceSubresources{}
+		if err := v1.Convert_apiextensions_CustomResourceSubresources_To_v1_CustomResourceSubresources(d.Subresources, j.Subresources, nil); err != nil {
+			return nil, err
+		}
+	}
+	if d.Conversion != nil {
+		j.Conversion = &v1.CustomResourceConversion{}
+		if err := v1.Convert_apiextensions_CustomResourceConversion_To_v1_CustomResourceConversion(d.Conversion, j.Conversion, nil); err != nil {
+			return nil, err
+		}
+	}
+	if err := v1.Convert_apiextensions_JSONSchemaProps_To_v1_JSONSchemaProps(&d.Schema, &j.Schema, nil); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// kubeVersionNames returns the names of the Kubernetes releases that CRDs are
+// checked against for compatibility.
+func kubeVersionNames() []string {
+	names := make([]string, 0, len(crdutil.KubeVersions))
+	for _, kv := range crdutil.KubeVersions {
+		names = append(names, kv.Name)
+	}
+	return names
+}
+
+// upgradeComment returns a YAML comment listing the fixes made to upgrade a
+// CRD to v1, and the problems that remain if it is still invalid.
+func upgradeComment(fixes []crdutil.Fix, err error) []byte {
+	b := &bytes.Buffer{}
+	if len(fixes) > 0 {
+		b.WriteString("# Fixed to upgrade to apiextensions.k8s.io/v1:\n")
+	}
+	for _, f := range fixes {
+		b.WriteString("# - ")
+		if f.Version != "" {
+			fmt.Fprintf(b, "%s: ", f.Version)
+		}
+		if f.Path != "" {
+			fmt.Fprintf(b, "%s: ", f.Path)
+		}
+		b.WriteString(f.Message + "\n")
+	}
+	var verr *crdutil.ValidationError
+	if errors.As(err, &verr) {
+		b.WriteString("# Still invalid as apiextensions.k8s.io/v1:\n")
+		for _, e := range verr.Errors {
+			fmt.Fprintf(b, "# - %s\n", e)
+		}
+	}
+	return b.Bytes()
+}
+
+// storedCRD is what is stored about an indexed CRD besides the CRD itself.
+type storedCRD struct {
+	// Tag is the name of the tag the CRD was found at.
+	Tag string
+	// Warnings are the validation errors of the CRD if it was indexed
+	// leniently.
+	Warnings []*crdutil.FieldError
+	// Deprecated maps the names of deprecated versions of the CRD to their
+	// deprecation warnings.
+	Deprecated map[string]string
+}
+
+// getCRD populates crd with the CRD of the specified group, version and kind
+// in repo at tag, or at the latest tag if tag is empty, and returns what else
+// is stored about it.
+func getCRD(crd *apiextensions.CustomResourceDefinition, org, repo, group, version, kind, tag string) (storedCRD, error) {
+	fullRepo := fmt.Sprintf("%s/%s/%s", "github.com", org, repo)
+	stored := storedCRD{Tag: tag}
+	foundTag, c, err := db.CRD(context.Background(), fullRepo, tag, group, version, kind)
+	if err != nil {
+		return stored, err
+	}
+	stored.Tag = foundTag
+	return stored, decodeCRD(*c, crd, &stored.Warnings, &stored.Deprecated)
+}
+
+// getRepoCRDs returns the CRDs in a repo at a tag, or at the latest tag if
+// tag is empty, along with the tag that was found.
+func getRepoCRDs(fullRepo, tag string) (string, []*apiextensions.CustomResourceDefinition, error) {
+	foundTag, stored, err := db.CRDs(context.Background(), fullRepo, tag)
+	if err != nil {
+		return "", nil, err
+	}
+	crds := []*apiextensions.CustomResourceDefinition{}
+	for _, c := range stored {
+		crd := &apiextensions.CustomResourceDefinition{}
+		if err := decodeCRD(c, crd, nil, nil); err != nil {
+			return "", nil, err
+		}
+		crds = append(crds, crd)
+	}
+	return foundTag, crds, nil
+}
+
+// decodeCRD decodes a stored CRD into crd, and its warnings and deprecated
+// versions into warnings and deprecated unless they are nil.
+func decodeCRD(c models.RepoCRD, crd *apiextensions.CustomResourceDefinition, warnings *[]*crdutil.FieldError, deprecated *map[string]string) error {
+	if err := yaml.Unmarshal(c.CRD, crd); err != nil {
+		return err
+	}
+	if warnings != nil && len(c.Warnings) > 0 {
+		if err := json.Unmarshal(c.Warnings, warnings); err != nil {
+			return err
+		}
+	}
+	if deprecated != nil && len(c.Deprecated) > 0 {
+		if err := json.Unmarshal(c.Deprecated, deprecated); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // TODO(hasheddan): add testing and more reliable parse
 func parseGHURL(uPath string) (org, repo, group, version, kind, tag string, err error) {
 	u, err := url.Parse(uPath)
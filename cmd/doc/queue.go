@@ -0,0 +1,280 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crdsdev/doc/pkg/models"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// clientTTL is how long a client's rate limiter is retained after its
+	// last request.
+	clientTTL = 10 * time.Minute
+	// statusTTL is how long the status of a finished job is retained.
+	statusTTL = time.Hour
+	// refreshClientID is the client that stale repos are queued for when
+	// their page is viewed, so that refreshes do not count against the rate
+	// limits of visitors.
+	refreshClientID = "refresh"
+)
+
+// enqueueResult is the outcome of a request to index a repo.
+type enqueueResult int
+
+const (
+	enqueued enqueueResult = iota
+	alreadyQueued
+	rateLimited
+	denied
+)
+
+// message returns a user-facing description of the result.
+func (e enqueueResult) message() string {
+	switch e {
+	case alreadyQueued:
+		return "This version of this repo is already queued for indexing. Check back shortly."
+	case rateLimited:
+		return "We are indexing too many repos right now. Please try again later."
+	case denied:
+		return "This repo is not available for indexing."
+	default:
+		return "Oops! Looks like we haven't indexed this version of this repo yet. We are working on that now..."
+	}
+}
+
+// jobState is the state of an index job.
+type jobState string
+
+const (
+	jobQueued    jobState = "queued"
+	jobRunning   jobState = "running"
+	jobSucceeded jobState = "succeeded"
+	jobFailed    jobState = "failed"
+)
+
+// jobStatus is the status of the most recent index job for a repo and tag.
+type jobStatus struct {
+	State    jobState
+	Attempts int
+	Error    string
+	Updated  time.Time
+}
+
+func (s jobStatus) finished() bool {
+	return s.State == jobSucceeded || s.State == jobFailed
+}
+
+type client struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+// indexQueue deduplicates and rate limits requests to index repos before they
+// are handed to gitter workers.
+type indexQueue struct {
+	jobs chan models.GitterRepo
+
+	mu       sync.Mutex
+	statuses map[string]*jobStatus
+	clients  map[string]*client
+	global   *rate.Limiter
+	perMin   int
+	denylist map[string]bool
+}
+
+// newIndexQueue returns a queue holding at most size pending jobs. At most
+// globalPerMin repos are queued per minute overall and clientPerMin per
+// client. Entries in denylist are either an org or an org/repo.
+func newIndexQueue(size, globalPerMin, clientPerMin int, denylist []string) *indexQueue {
+	q := &indexQueue{
+		jobs:     make(chan models.GitterRepo, size),
+		statuses: map[string]*jobStatus{},
+		clients:  map[string]*client{},
+		global:   rate.NewLimiter(perMinute(globalPerMin), globalPerMin),
+		perMin:   clientPerMin,
+		denylist: map[string]bool{},
+	}
+	for _, d := range denylist {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			q.denylist[d] = true
+		}
+	}
+	return q
+}
+
+func perMinute(n int) rate.Limit {
+	if n <= 0 {
+		return rate.Inf
+	}
+	return rate.Every(time.Minute / time.Duration(n))
+}
+
+func jobKey(repo models.GitterRepo) string {
+	return strings.ToLower(repo.Org+"/"+repo.Repo) + "@" + repo.Tag
+}
+
+// enqueue attempts to queue repo for indexing on behalf of clientID.
+func (q *indexQueue) enqueue(repo models.GitterRepo, clientID string) enqueueResult {
+	org := strings.ToLower(repo.Org)
+	if q.denylist[org] || q.denylist[org+"/"+strings.ToLower(repo.Repo)] {
+		return denied
+	}
+	key := jobKey(repo)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pruneStatuses()
+	if s, ok := q.statuses[key]; ok && !s.finished() {
+		return alreadyQueued
+	}
+	if len(q.jobs) == cap(q.jobs) {
+		return rateLimited
+	}
+	// Tokens are only taken if the repo is queued, so that a request that is
+	// turned away does not count against the client.
+	now := time.Now()
+	reservations, ok := reserve(now, q.global, q.clientLimiter(clientID))
+	if !ok {
+		return rateLimited
+	}
+	select {
+	case q.jobs <- repo:
+		q.statuses[key] = &jobStatus{State: jobQueued, Updated: now}
+		return enqueued
+	default:
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+		return rateLimited
+	}
+}
+
+// reserve takes a token from each of limiters. If any of them has no token
+// available at now, none are taken.
+func reserve(now time.Time, limiters ...*rate.Limiter) ([]*rate.Reservation, bool) {
+	var reservations []*rate.Reservation
+	for _, l := range limiters {
+		r := l.ReserveN(now, 1)
+		if !r.OK() || r.DelayFrom(now) > 0 {
+			r.CancelAt(now)
+			for _, prev := range reservations {
+				prev.CancelAt(now)
+			}
+			return nil, false
+		}
+		reservations = append(reservations, r)
+	}
+	return reservations, true
+}
+
+// status returns the status of the most recent job for repo.
+func (q *indexQueue) status(repo models.GitterRepo) (jobStatus, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, ok := q.statuses[jobKey(repo)]
+	if !ok {
+		return jobStatus{}, false
+	}
+	return *s, true
+}
+
+// attempt records that an attempt to index repo has started.
+func (q *indexQueue) attempt(repo models.GitterRepo) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, ok := q.statuses[jobKey(repo)]
+	if !ok {
+		s = &jobStatus{}
+		q.statuses[jobKey(repo)] = s
+	}
+	s.State = jobRunning
+	s.Attempts++
+	s.Updated = time.Now()
+}
+
+// done records the result of indexing repo. Once done, repo may be queued
+// again.
+func (q *indexQueue) done(repo models.GitterRepo, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, ok := q.statuses[jobKey(repo)]
+	if !ok {
+		s = &jobStatus{}
+		q.statuses[jobKey(repo)] = s
+	}
+	s.State = jobSucceeded
+	s.Error = ""
+	if err != nil {
+		s.State = jobFailed
+		s.Error = err.Error()
+	}
+	s.Updated = time.Now()
+}
+
+// pruneStatuses removes the statuses of jobs that finished more than
+// statusTTL ago. q.mu must be held.
+func (q *indexQueue) pruneStatuses() {
+	now := time.Now()
+	for key, s := range q.statuses {
+		if s.finished() && now.Sub(s.Updated) > statusTTL {
+			delete(q.statuses, key)
+		}
+	}
+}
+
+// clientLimiter returns the limiter for clientID, pruning limiters of clients
+// that have not been seen recently. q.mu must be held.
+func (q *indexQueue) clientLimiter(clientID string) *rate.Limiter {
+	now := time.Now()
+	for id, c := range q.clients {
+		if now.Sub(c.seen) > clientTTL {
+			delete(q.clients, id)
+		}
+	}
+	c, ok := q.clients[clientID]
+	if !ok {
+		c = &client{limiter: rate.NewLimiter(perMinute(q.perMin), q.perMin)}
+		q.clients[clientID] = c
+	}
+	c.seen = now
+	return c.limiter
+}
+
+// clientID identifies the client that made r, preferring the address
+// reported by a load balancer. Only the last entry of X-Forwarded-For is
+// used, as it is added by the load balancer, while earlier entries are
+// supplied by the client.
+func clientID(r *http.Request) string {
+	if fwd := r.Header["X-Forwarded-For"]; len(fwd) > 0 {
+		hops := strings.Split(fwd[len(fwd)-1], ",")
+		if last := strings.TrimSpace(hops[len(hops)-1]); last != "" {
+			return last
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/crdsdev/doc/pkg/models"
+)
+
+type queueRequest struct {
+	repo   models.GitterRepo
+	client string
+}
+
+func TestEnqueue(t *testing.T) {
+	repoA := models.GitterRepo{Org: "org", Repo: "a", Tag: "v1"}
+	repoB := models.GitterRepo{Org: "org", Repo: "b", Tag: "v1"}
+	cases := []struct {
+		name      string
+		size      int
+		globalMin int
+		clientMin int
+		denylist  []string
+		before    []queueRequest
+		request   queueRequest
+		expected  enqueueResult
+	}{
+		{
+			name:      "Enqueued",
+			size:      2,
+			globalMin: 10,
+			clientMin: 10,
+			request:   queueRequest{repoA, "a"},
+			expected:  enqueued,
+		},
+		{
+			name:     "Unlimited",
+			size:     2,
+			before:   []queueRequest{{repoA, "a"}},
+			request:  queueRequest{repoB, "a"},
+			expected: enqueued,
+		},
+		{
+			name:      "AlreadyQueued",
+			size:      2,
+			globalMin: 10,
+			clientMin: 10,
+			before:    []queueRequest{{repoA, "a"}},
+			request:   queueRequest{models.GitterRepo{Org: "Org", Repo: "A", Tag: "v1"}, "b"},
+			expected:  alreadyQueued,
+		},
+		{
+			name:      "OtherTag",
+			size:      2,
+			globalMin: 10,
+			clientMin: 10,
+			before:    []queueRequest{{repoA, "a"}},
+			request:   queueRequest{models.GitterRepo{Org: "org", Repo: "a", Tag: "v2"}, "b"},
+			expected:  enqueued,
+		},
+		{
+			name:     "DeniedOrg",
+			size:     2,
+			denylist: []string{" Org "},
+			request:  queueRequest{repoA, "a"},
+			expected: denied,
+		},
+		{
+			name:     "DeniedRepo",
+			size:     2,
+			denylist: []string{"org/A"},
+			request:  queueRequest{repoA, "a"},
+			expected: denied,
+		},
+		{
+			name:     "OtherRepoNotDenied",
+			size:     2,
+			denylist: []string{"org/a"},
+			request:  queueRequest{repoB, "a"},
+			expected: enqueued,
+		},
+		{
+			name:      "ClientRateLimited",
+			size:      2,
+			globalMin: 10,
+			clientMin: 1,
+			before:    []queueRequest{{repoA, "a"}},
+			request:   queueRequest{repoB, "a"},
+			expected:  rateLimited,
+		},
+		{
+			name:      "OtherClient",
+			size:      2,
+			globalMin: 10,
+			clientMin: 1,
+			before:    []queueRequest{{repoA, "a"}},
+			request:   queueRequest{repoB, "b"},
+			expected:  enqueued,
+		},
+		{
+			name:      "GlobalRateLimited",
+			size:      2,
+			globalMin: 1,
+			clientMin: 10,
+			before:    []queueRequest{{repoA, "a"}},
+			request:   queueRequest{repoB, "b"},
+			expected:  rateLimited,
+		},
+		{
+			name:      "QueueFull",
+			size:      1,
+			globalMin: 10,
+			clientMin: 10,
+			before:    []queueRequest{{repoA, "a"}},
+			request:   queueRequest{repoB, "b"},
+			expected:  rateLimited,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newIndexQueue(tc.size, tc.globalMin, tc.clientMin, tc.denylist)
+			for _, r := range tc.before {
+				if res := q.enqueue(r.repo, r.client); res != enqueued {
+					t.Fatalf("enqueue(%v, %q): got %v, want %v", r.repo, r.client, res, enqueued)
+				}
+			}
+			if res := q.enqueue(tc.request.repo, tc.request.client); res != tc.expected {
+				t.Errorf("enqueue(%v, %q): got %v, want %v", tc.request.repo, tc.request.client, res, tc.expected)
+			}
+		})
+	}
+}
+
+func TestEnqueueKeepsTokens(t *testing.T) {
+	repoA := models.GitterRepo{Org: "org", Repo: "a", Tag: "v1"}
+	repoB := models.GitterRepo{Org: "org", Repo: "b", Tag: "v1"}
+	repoC := models.GitterRepo{Org: "org", Repo: "c", Tag: "v1"}
+	q := newIndexQueue(1, 2, 1, nil)
+	if res := q.enqueue(repoA, "a"); res != enqueued {
+		t.Fatalf("enqueue(%v): got %v, want %v", repoA, res, enqueued)
+	}
+	// Turned away as the queue is full, without taking a token from either
+	// limiter.
+	if res := q.enqueue(repoB, "b"); res != rateLimited {
+		t.Fatalf("enqueue(%v): got %v, want %v", repoB, res, rateLimited)
+	}
+	<-q.jobs
+	q.done(repoA, nil)
+	if res := q.enqueue(repoB, "b"); res != enqueued {
+		t.Fatalf("enqueue(%v): got %v, want %v", repoB, res, enqueued)
+	}
+	<-q.jobs
+	q.done(repoB, nil)
+	// Turned away by the global limiter, without taking the token of the
+	// client.
+	if res := q.enqueue(repoC, "c"); res != rateLimited {
+		t.Fatalf("enqueue(%v): got %v, want %v", repoC, res, rateLimited)
+	}
+	if _, ok := q.clients["c"]; !ok {
+		t.Fatal("Expected a limiter for client c")
+	}
+	if !q.clients["c"].limiter.Allow() {
+		t.Error("Expected client c to keep its token")
+	}
+}
+
+func TestClientID(t *testing.T) {
+	cases := []struct {
+		name      string
+		forwarded []string
+		expected  string
+	}{
+		{name: "RemoteAddr", expected: "10.0.0.1"},
+		{name: "Forwarded", forwarded: []string{"203.0.113.1"}, expected: "203.0.113.1"},
+		{name: "LastHop", forwarded: []string{"198.51.100.7, 203.0.113.1"}, expected: "203.0.113.1"},
+		{name: "LastHeader", forwarded: []string{"198.51.100.7", "192.0.2.9, 203.0.113.1"}, expected: "203.0.113.1"},
+		{name: "Empty", forwarded: []string{""}, expected: "10.0.0.1"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &http.Request{RemoteAddr: "10.0.0.1:34567", Header: http.Header{}}
+			for _, f := range tc.forwarded {
+				r.Header.Add("X-Forwarded-For", f)
+			}
+			if got := clientID(r); got != tc.expected {
+				t.Errorf("clientID(): got %q, want %q", got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	crdutil "github.com/crdsdev/doc/pkg/crd"
+	"github.com/gorilla/mux"
+)
+
+// scorecard is the lint findings for each CRD in a repo at a tag. Score is
+// the mean of the scores of the CRDs.
+type scorecard struct {
+	Repo  string         `json:"repo"`
+	Tag   string         `json:"tag"`
+	Score int            `json:"score"`
+	CRDs  []crdScorecard `json:"crds"`
+}
+
+type crdScorecard struct {
+	Group    string            `json:"group"`
+	Version  string            `json:"version"`
+	Kind     string            `json:"kind"`
+	Score    int               `json:"score"`
+	Findings []crdutil.Finding `json:"findings"`
+}
+
+type scorecardData struct {
+	Page  pageData
+	Rules []crdutil.LintRule
+	scorecard
+}
+
+// repoScorecard renders the lint findings for the CRDs in a repo at a tag,
+// as JSON if the format query parameter is json.
+func repoScorecard(w http.ResponseWriter, r *http.Request) {
+	parameters := mux.Vars(r)
+	org := parameters["org"]
+	repo := parameters["repo"]
+	tag := parameters["tag"]
+	fullRepo := fmt.Sprintf("%s/%s/%s", "github.com", org, repo)
+
+	sc, err := getScorecard(fullRepo, tag)
+	if err != nil {
+		log.Printf("failed to get scorecard for %s : %v", repo, err)
+		http.Error(w, "Unable to get scorecard.", http.StatusInternalServerError)
+		return
+	}
+	if len(sc.CRDs) == 0 {
+		http.Error(w, "Unable to find CRDs for this repo and tag.", http.StatusNotFound)
+		return
+	}
+	sc.Repo = strings.Join([]string{org, repo}, "/")
+
+	if r.URL.Query().Get("format") == "json" {
+		if err := page.JSON(w, http.StatusOK, sc); err != nil {
+			log.Printf("failed to render scorecard JSON: %v", err)
+		}
+		return
+	}
+	pageData := getPageData(r, fmt.Sprintf("%s@%s scorecard", sc.Repo, sc.Tag), false)
+	if err := page.HTML(w, http.StatusOK, "scorecard", scorecardData{
+		Page:      pageData,
+		Rules:     crdutil.LintRules,
+		scorecard: *sc,
+	}); err != nil {
+		log.Printf("scorecardTemplate.Execute(): %v", err)
+		fmt.Fprint(w, "Unable to render scorecard template.")
+		return
+	}
+	log.Printf("successfully rendered scorecard template")
+}
+
+func getScorecard(fullRepo, tag string) (*scorecard, error) {
+	foundTag, crds, err := getRepoCRDs(fullRepo, tag)
+	if err != nil {
+		return nil, err
+	}
+	sc := &scorecard{Tag: foundTag, CRDs: []crdScorecard{}}
+	total := 0
+	for _, crd := range crds {
+		gvk := crdutil.GetStoredGVK(crd)
+		if gvk == nil {
+			continue
+		}
+		findings := crdutil.Lint(crd)
+		c := crdScorecard{
+			Group:    gvk.Group,
+			Version:  gvk.Version,
+			Kind:     gvk.Kind,
+			Score:    crdutil.Score(findings),
+			Findings: findings,
+		}
+		total += c.Score
+		sc.CRDs = append(sc.CRDs, c)
+	}
+	if len(sc.CRDs) > 0 {
+		sc.Score = total / len(sc.CRDs)
+	}
+	sort.Slice(sc.CRDs, func(i, j int) bool {
+		if sc.CRDs[i].Group != sc.CRDs[j].Group {
+			return sc.CRDs[i].Group < sc.CRDs[j].Group
+		}
+		return sc.CRDs[i].Kind < sc.CRDs[j].Kind
+	})
+	return sc, nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/crdsdev/doc/pkg/gitter"
+	"github.com/crdsdev/doc/pkg/models"
+)
+
+const (
+	gitterTokenEnv = "GITTER_TOKEN"
+
+	cancelTimeout  = 10 * time.Second
+	initialBackoff = time.Second
+	maxBackoff     = 30 * time.Second
+)
+
+// newGitterClient returns a client for the gitter API configured by flags and
+// environment.
+func newGitterClient() (*gitter.Client, error) {
+	opts := []gitter.ClientOption{gitter.WithToken(os.Getenv(gitterTokenEnv))}
+	if *gitterCert != "" || *gitterCA != "" {
+		cfg, err := gitter.ClientTLSConfig(*gitterCert, *gitterKey, *gitterCA)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, gitter.WithHTTPClient(&http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: cfg,
+			},
+		}))
+	}
+	return gitter.NewClient(*gitterURL, opts...), nil
+}
+
+func worker(c *gitter.Client, q *indexQueue) {
+	for job := range q.jobs {
+		err := indexWithRetry(c, q, job)
+		if err != nil {
+			log.Printf("failed to index %s/%s@%s: %v", job.Org, job.Repo, job.Tag, err)
+		}
+		q.done(job, err)
+	}
+}
+
+// indexWithRetry indexes job, retrying with exponential backoff until it
+// succeeds, fails for a reason that retrying will not fix, the maximum number
+// of attempts is reached, or the job deadline passes.
+func indexWithRetry(c *gitter.Client, q *indexQueue, job models.GitterRepo) error {
+	ctx, cancel := context.WithTimeout(context.Background(), *indexTimeout)
+	defer cancel()
+	backoff := initialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		q.attempt(job)
+		if err = runJob(ctx, c, job); !gitter.IsRetryable(err) {
+			return err
+		}
+		if attempt >= *indexAttempts {
+			return err
+		}
+		log.Printf("attempt %d to index %s/%s@%s failed, retrying in %s: %v", attempt, job.Org, job.Repo, job.Tag, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// runJob submits job to gitter and waits for it to finish. If ctx is done
+// first, the job is canceled.
+func runJob(ctx context.Context, c *gitter.Client, job models.GitterRepo) error {
+	j, err := c.Submit(ctx, job)
+	if err != nil {
+		return err
+	}
+	if _, err := c.Watch(ctx, j.ID, nil); err != nil {
+		if ctx.Err() != nil {
+			cctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+			defer cancel()
+			if _, err := c.Cancel(cctx, j.ID); err != nil {
+				log.Printf("failed to cancel job %s: %v", j.ID, err)
+			}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command docgen generates API reference documentation for CRDs in local
+// files, without a database or web server.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	crdutil "github.com/crdsdev/doc/pkg/crd"
+	flag "github.com/spf13/pflag"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+const (
+	formatMarkdown = "markdown"
+	formatHTML     = "html"
+)
+
+var (
+	format = flag.StringP("format", "f", formatMarkdown, "Output format: markdown or html.")
+	output = flag.StringP("output", "o", "", "Directory to write one file per CRD version to. Defaults to stdout.")
+)
+
+// refData is the reference documentation for a single version of a CRD.
+type refData struct {
+	Group       string
+	Version     string
+	Kind        string
+	Plural      string
+	Scope       string
+	Description string
+	Fields      []crdutil.Field
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: docgen [flags] <file-or-dir>...\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *format != formatMarkdown && *format != formatHTML {
+		log.Fatalf("unknown format %q", *format)
+	}
+	files, err := findFiles(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	refs := []refData{}
+	for _, f := range files {
+		r, err := readRefs(f)
+		if err != nil {
+			log.Fatalf("failed to read %s: %v", f, err)
+		}
+		refs = append(refs, r...)
+	}
+	if len(refs) == 0 {
+		log.Fatal("no CRDs found")
+	}
+	if err := write(refs); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// findFiles returns the YAML and JSON files in paths, walking directories.
+func findFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		if err := filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			switch filepath.Ext(path) {
+			case ".yaml", ".yml", ".json":
+				if !info.IsDir() {
+					files = append(files, path)
+				}
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// readRefs returns the reference documentation for each served version of
+// each CRD in a file. Documents that are not CRDs are skipped, and documents
+// that cannot be read, such as templates, are logged and skipped.
+func readRefs(file string) ([]refData, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	docs, err := crdutil.ReadCRDers(f)
+	var serr *crdutil.StreamError
+	if errors.As(err, &serr) {
+		for _, de := range serr.Errors {
+			log.Printf("skipping %s: %v", file, de)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	var refs []refData
+	for _, d := range docs {
+		for _, v := range d.CRDer.CRD.Spec.Versions {
+			if v.Served {
+				refs = append(refs, newRefData(d.CRDer.CRD, v.Name))
+			}
+		}
+	}
+	return refs, nil
+}
+
+func newRefData(crd *apiextensions.CustomResourceDefinition, version string) refData {
+	r := refData{
+		Group:   crd.Spec.Group,
+		Version: version,
+		Kind:    crd.Spec.Names.Kind,
+		Plural:  crd.Spec.Names.Plural,
+		Scope:   string(crd.Spec.Scope),
+	}
+	sv := crd.Spec.Validation
+	for _, v := range crd.Spec.Versions {
+		if sv == nil && v.Name == version {
+			sv = v.Schema
+		}
+	}
+	if sv != nil && sv.OpenAPIV3Schema != nil {
+		r.Description = sv.OpenAPIV3Schema.Description
+		r.Fields = crdutil.Fields(sv.OpenAPIV3Schema)
+	}
+	return r
+}
+
+// write renders refs to stdout, or to a file for each in the output
+// directory.
+func write(refs []refData) error {
+	sort.Slice(refs, func(i, j int) bool {
+		a, b := refs[i], refs[j]
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Version < b.Version
+	})
+	ext := ".md"
+	if *format == formatHTML {
+		ext = ".html"
+	}
+	if *output != "" {
+		if err := os.MkdirAll(*output, 0755); err != nil {
+			return err
+		}
+	}
+	for i, r := range refs {
+		b := &bytes.Buffer{}
+		if err := render(b, r); err != nil {
+			return err
+		}
+		if *output == "" {
+			if i > 0 && *format == formatMarkdown {
+				fmt.Println("\n---")
+			}
+			if _, err := os.Stdout.Write(b.Bytes()); err != nil {
+				return err
+			}
+			continue
+		}
+		name := strings.ToLower(fmt.Sprintf("%s_%s_%s", r.Group, r.Kind, r.Version)) + ext
+		if err := ioutil.WriteFile(filepath.Join(*output, name), b.Bytes(), 0644); err != nil {
+			return err
+		}
+		log.Printf("wrote %s", name)
+	}
+	return nil
+}
+
+func render(w io.Writer, r refData) error {
+	if *format == formatHTML {
+		return htmlTemplate.Execute(w, r)
+	}
+	return markdownTemplate.Execute(w, r)
+}
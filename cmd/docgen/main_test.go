@@ -0,0 +1,139 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// docgencrd has a malformed document, as in a Helm chart, and a CRD with an
+// unserved version.
+var docgencrd = []byte(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: example
+---
+kind: CustomResourceDefinition
+spec: {{ .Values.spec }}
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        description: CronTab runs a job on a schedule.
+        properties:
+          apiVersion:
+            type: string
+          kind:
+            type: string
+          metadata:
+            type: object
+          spec:
+            type: object
+            required:
+            - schedule
+            properties:
+              schedule:
+                type: string
+                description: Schedule in cron format.
+                pattern: '^\S+$'
+              replicas:
+                type: integer
+                default: 1
+  - name: v1alpha1
+    served: false
+    storage: false
+    schema:
+      openAPIV3Schema:
+        type: object
+  scope: Namespaced
+  names:
+    plural: crontabs
+    kind: CronTab
+`)
+
+func TestRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "crontab.yaml")
+	if err := ioutil.WriteFile(file, docgencrd, 0644); err != nil {
+		t.Fatal(err)
+	}
+	refs, err := readRefs(file)
+	if err != nil {
+		t.Fatalf("readRefs(): %v", err)
+	}
+	if len(refs) != 1 {
+		t.Fatalf("readRefs(): got %d refs, want the served version only", len(refs))
+	}
+	defer func(f string) { *format = f }(*format)
+
+	*format = formatMarkdown
+	b := &bytes.Buffer{}
+	if err := render(b, refs[0]); err != nil {
+		t.Fatalf("render(): %v", err)
+	}
+	expected := "# CronTab\n\n" +
+		"| Group | Version | Kind | Scope |\n" +
+		"| ----- | ------- | ---- | ----- |\n" +
+		"| `example.com` | `v1` | `CronTab` | Namespaced |\n\n" +
+		"```yaml\napiVersion: example.com/v1\nkind: CronTab\n```\n\n" +
+		"CronTab runs a job on a schedule.\n\n" +
+		"## Fields\n\n" +
+		"<a id=\"spec\"></a>\n### `spec`\n\n**Type:** `object`\n\n" +
+		"<a id=\"spec-replicas\"></a>\n### `spec.replicas`\n\n**Type:** `integer`\n\n- **Default:** `1`\n\n" +
+		"<a id=\"spec-schedule\"></a>\n### `spec.schedule`\n\n**Type:** `string` · **Required**\n\nSchedule in cron format.\n\n- `pattern: ^\\S+$`\n"
+	if b.String() != expected {
+		t.Errorf("Expected markdown:\n%s\ngot:\n%s", expected, b)
+	}
+
+	*format = formatHTML
+	b.Reset()
+	if err := render(b, refs[0]); err != nil {
+		t.Fatalf("render(): %v", err)
+	}
+	for _, want := range []string{
+		`<title>CronTab.v1.example.com</title>`,
+		`<details id="spec" open>`,
+		`<summary><a href="#spec-schedule">schedule</a> <kbd>string</kbd> <span class="required">required</span></summary>`,
+		`<li>default: <code>1</code></li>`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("Expected HTML to contain %s, got:\n%s", want, b)
+		}
+	}
+	if strings.Contains(b.String(), `id="metadata"`) {
+		t.Errorf("Expected HTML without metadata, got:\n%s", b)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+)
+
+var funcs = template.FuncMap{
+	"trim": strings.TrimSpace,
+}
+
+// markdownTemplate lists every field, depth first, under a heading with an
+// anchor that matches the doc page.
+var markdownTemplate = template.Must(template.New("markdown").Funcs(funcs).Parse(`# {{ .Kind }}
+
+| Group | Version | Kind | Scope |
+| ----- | ------- | ---- | ----- |
+| ` + "`{{ .Group }}`" + ` | ` + "`{{ .Version }}`" + ` | ` + "`{{ .Kind }}`" + ` | {{ .Scope }} |
+
+` + "```yaml" + `
+apiVersion: {{ .Group }}/{{ .Version }}
+kind: {{ .Kind }}
+` + "```" + `
+{{ with trim .Description }}
+{{ . }}
+{{ end }}
+## Fields
+{{ if not .Fields }}
+This CRD has an empty or unspecified schema.
+{{ end }}{{ template "fields" .Fields }}
+{{- define "fields" }}{{ range . }}
+<a id="{{ .Anchor }}"></a>
+### ` + "`{{ .Path }}`" + `
+
+**Type:** ` + "`{{ if .Type }}{{ .Type }}{{ else }}any{{ end }}`" + `{{ if .Required }} · **Required**{{ end }}
+{{ with trim .Description }}
+{{ . }}
+{{ end }}{{ if or .Default .Constraints }}
+{{ with .Default }}- **Default:** ` + "`{{ . }}`" + `
+{{ end }}{{ range .Constraints }}- ` + "`{{ . }}`" + `
+{{ end }}{{ end }}{{ template "fields" .Fields }}{{ end }}{{ end }}`))
+
+// htmlTemplate renders a standalone page with the fields in a collapsible
+// tree, as on the doc page.
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap(funcs)).Parse(`<!doctype html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>{{ .Kind }}.{{ .Version }}.{{ .Group }}</title>
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; max-width: 960px; margin: 2rem auto; padding: 0 1rem; line-height: 1.5; }
+        code, kbd, pre { font-family: SFMono-Regular, Menlo, Consolas, monospace; }
+        pre { background: #f5f5f5; padding: 1rem; }
+        kbd { color: #6c757d; }
+        details { border-left: 2px solid #e0e0e0; margin: 0.5rem 0; padding-left: 1rem; }
+        summary { cursor: pointer; font-weight: 600; }
+        .required { background: #1890ff; color: #fff; border-radius: 4px; font-size: 0.75rem; padding: 0 0.4rem; }
+        .description { white-space: pre-wrap; }
+        .constraints { color: #6c757d; font-size: 0.9rem; }
+    </style>
+</head>
+<body>
+    <h1>{{ .Kind }}</h1>
+    <p><b>Group</b> <code>{{ .Group }}</code> &middot; <b>Version</b> <code>{{ .Version }}</code> &middot; <b>Scope</b> {{ .Scope }}</p>
+    <pre><code>apiVersion: {{ .Group }}/{{ .Version }}
+kind: {{ .Kind }}</code></pre>
+    {{ with trim .Description }}<p class="description">{{ . }}</p>{{ end }}
+    {{ if .Fields }}{{ template "fields" .Fields }}{{ else }}<p>This CRD has an empty or unspecified schema.</p>{{ end }}
+    <script>
+        // Open the field that is linked to, and the fields that contain it.
+        function openHash() {
+            let el = document.getElementById(decodeURIComponent(location.hash.substring(1)));
+            for (; el; el = el.parentElement) {
+                if (el.tagName === 'DETAILS') {
+                    el.open = true;
+                }
+            }
+        }
+        window.addEventListener('hashchange', openHash);
+        openHash();
+    </script>
+</body>
+</html>
+{{ define "fields" }}{{ range . }}
+<details id="{{ .Anchor }}"{{ if eq .Path "spec" }} open{{ end }}>
+    <summary><a href="#{{ .Anchor }}">{{ .Name }}</a> <kbd>{{ .Type }}</kbd>{{ if .Required }} <span class="required">required</span>{{ end }}</summary>
+    {{ with trim .Description }}<p class="description">{{ . }}</p>{{ end }}
+    {{ if or .Default .Constraints }}<ul class="constraints">
+        {{ with .Default }}<li>default: <code>{{ . }}</code></li>{{ end }}
+        {{ range .Constraints }}<li>{{ . }}</li>{{ end }}
+    </ul>{{ end }}
+    {{ template "fields" .Fields }}
+</details>{{ end }}{{ end }}`))
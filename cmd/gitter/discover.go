@@ -0,0 +1,315 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/crdsdev/doc/pkg/crd"
+	"github.com/crdsdev/doc/pkg/models"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"gopkg.in/square/go-jose.v2/json"
+)
+
+var (
+	crdReg  = regexp.MustCompile("kind: CustomResourceDefinition")
+	yamlReg = regexp.MustCompile(`^.*\.yaml`)
+)
+
+type tag struct {
+	hash plumbing.Hash
+	name string
+}
+
+// tagCRDs are the CRDs discovered at a single tag of a repository. commit is
+// nil if the tag could not be resolved or if a local working tree was
+// scanned. total is the number of tags being discovered.
+type tagCRDs struct {
+	name   string
+	total  int
+	commit *object.Commit
+	crds   map[string]models.RepoCRD
+	errors []fileError
+}
+
+// fileError is a failure to read or parse a file that appears to contain a
+// CRD.
+type fileError struct {
+	Filename string `json:"filename,omitempty"`
+	Error    string `json:"error"`
+}
+
+// discover finds the CRDs at each tag of the repository at src, or only at
+// tagName if it is not empty, and calls fn with the result for each tag. If
+// src is a local directory it is opened in place; the working tree is scanned
+// as-is when no tag is specified, otherwise tags are read from the object
+// store without modifying the checkout.
+func discover(ctx context.Context, src string, tagName string, fn func(tagCRDs) error) error {
+	if info, err := os.Stat(src); err == nil && info.IsDir() {
+		if tagName == "" {
+			crds, errs := getCRDsFromDir(src)
+			return fn(tagCRDs{total: 1, crds: crds, errors: errs})
+		}
+		repo, err := git.PlainOpenWithOptions(src, &git.PlainOpenOptions{DetectDotGit: true})
+		if err != nil {
+			return err
+		}
+		return walkTags(ctx, repo, tagName, func(t tag, c *object.Commit) (map[string]models.RepoCRD, []fileError, error) {
+			return getCRDsFromCommit(c)
+		}, fn)
+	}
+
+	dir, err := ioutil.TempDir(os.TempDir(), "doc-gitter")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	cloneOpts := &git.CloneOptions{
+		URL:               src,
+		Depth:             1,
+		Progress:          os.Stderr,
+		RecurseSubmodules: git.NoRecurseSubmodules,
+	}
+	if tagName != "" {
+		cloneOpts.ReferenceName = plumbing.NewTagReferenceName(tagName)
+		cloneOpts.SingleBranch = true
+	}
+	repo, err := git.PlainCloneContext(ctx, dir, false, cloneOpts)
+	if err != nil {
+		return err
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	return walkTags(ctx, repo, tagName, func(t tag, c *object.Commit) (map[string]models.RepoCRD, []fileError, error) {
+		return getCRDsFromTag(dir, t.name, &c.Hash, w)
+	}, fn)
+}
+
+type tagReader func(t tag, c *object.Commit) (map[string]models.RepoCRD, []fileError, error)
+
+func walkTags(ctx context.Context, repo *git.Repository, tagName string, read tagReader, fn func(tagCRDs) error) error {
+	iter, err := repo.Tags()
+	if err != nil {
+		return err
+	}
+	// Get CRDs for each tag
+	tags := []tag{}
+	if err := iter.ForEach(func(obj *plumbing.Reference) error {
+		if tagName == "" {
+			tags = append(tags, tag{
+				hash: obj.Hash(),
+				name: obj.Name().Short(),
+			})
+			return nil
+		}
+		if obj.Name().Short() == tagName {
+			tags = append(tags, tag{
+				hash: obj.Hash(),
+				name: obj.Name().Short(),
+			})
+			iter.Close()
+		}
+		return nil
+	}); err != nil {
+		log.Println(err)
+	}
+	for _, t := range tags {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		h, err := repo.ResolveRevision(plumbing.Revision(t.hash.String()))
+		if err != nil || h == nil {
+			if err := fn(tagCRDs{name: t.name, total: len(tags), errors: []fileError{{Error: fmt.Sprintf("unable to resolve revision: %s (%v)", t.hash.String(), err)}}}); err != nil {
+				return err
+			}
+			continue
+		}
+		c, err := repo.CommitObject(*h)
+		if err != nil || c == nil {
+			if err := fn(tagCRDs{name: t.name, total: len(tags), errors: []fileError{{Error: fmt.Sprintf("unable to resolve commit: %s (%v)", h.String(), err)}}}); err != nil {
+				return err
+			}
+			continue
+		}
+		crds, errs, err := read(t, c)
+		if err != nil {
+			errs = append(errs, fileError{Error: fmt.Sprintf("unable to get CRDs: %v", err)})
+		}
+		if err := fn(tagCRDs{name: t.name, total: len(tags), commit: c, crds: crds, errors: errs}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getCRDsFromTag(dir string, tag string, hash *plumbing.Hash, w *git.Worktree) (map[string]models.RepoCRD, []fileError, error) {
+	err := w.Checkout(&git.CheckoutOptions{
+		Hash:  *hash,
+		Force: true,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := w.Reset(&git.ResetOptions{
+		Mode: git.HardReset,
+	}); err != nil {
+		return nil, nil, err
+	}
+	g, _ := w.Grep(&git.GrepOptions{
+		Patterns:  []*regexp.Regexp{crdReg},
+		PathSpecs: []*regexp.Regexp{yamlReg},
+	})
+	files := map[string][]byte{}
+	var errs []fileError
+	for _, res := range g {
+		b, err := ioutil.ReadFile(dir + "/" + res.FileName)
+		if err != nil {
+			errs = append(errs, fileError{Filename: res.FileName, Error: fmt.Sprintf("failed to read CRD file: %v", err)})
+			continue
+		}
+		files[res.FileName] = b
+	}
+	crds, parseErrs := getCRDs(files)
+	return crds, append(errs, parseErrs...), nil
+}
+
+func getCRDsFromCommit(c *object.Commit) (map[string]models.RepoCRD, []fileError, error) {
+	iter, err := c.Files()
+	if err != nil {
+		return nil, nil, err
+	}
+	files := map[string][]byte{}
+	if err := iter.ForEach(func(f *object.File) error {
+		if !yamlReg.MatchString(f.Name) {
+			return nil
+		}
+		contents, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		if crdReg.MatchString(contents) {
+			files[f.Name] = []byte(contents)
+		}
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+	crds, errs := getCRDs(files)
+	return crds, errs, nil
+}
+
+func getCRDsFromDir(dir string) (map[string]models.RepoCRD, []fileError) {
+	files := map[string][]byte{}
+	var errs []fileError
+	if err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || !yamlReg.MatchString(rel) {
+			return nil
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			errs = append(errs, fileError{Filename: rel, Error: fmt.Sprintf("failed to read CRD file: %v", err)})
+			return nil
+		}
+		if crdReg.Match(b) {
+			files[filepath.ToSlash(rel)] = b
+		}
+		return nil
+	}); err != nil {
+		errs = append(errs, fileError{Error: err.Error()})
+	}
+	crds, parseErrs := getCRDs(files)
+	return crds, append(errs, parseErrs...)
+}
+
+// getCRDs parses each document of each file and returns the CRDs found keyed
+// by GVK. Documents that are not CRDs are skipped silently.
+func getCRDs(files map[string][]byte) (map[string]models.RepoCRD, []fileError) {
+	repoCRDs := map[string]models.RepoCRD{}
+	var errs []fileError
+	for file, b := range files {
+		read := crd.ReadCRDers
+		if *lenient {
+			read = crd.ReadLenientCRDers
+		}
+		docs, err := read(bytes.NewReader(b), crd.StripLabels(), crd.StripAnnotations(), crd.RedactConversion())
+		var serr *crd.StreamError
+		if errors.As(err, &serr) {
+			for _, de := range serr.Errors {
+				errs = append(errs, fileError{Filename: file, Error: fmt.Sprintf("invalid CRD: %v", de)})
+			}
+		} else if err != nil {
+			errs = append(errs, fileError{Filename: file, Error: fmt.Sprintf("failed to read CRD file: %v", err)})
+			continue
+		}
+		for _, d := range docs {
+			crder := d.CRDer
+			cbytes, err := json.Marshal(crder.CRD)
+			if err != nil {
+				errs = append(errs, fileError{Filename: file, Error: err.Error()})
+				continue
+			}
+			var wbytes []byte
+			if len(crder.Warnings) > 0 {
+				if wbytes, err = json.Marshal(crder.Warnings); err != nil {
+					errs = append(errs, fileError{Filename: file, Error: err.Error()})
+					continue
+				}
+			}
+			var dbytes []byte
+			if len(crder.Deprecated) > 0 {
+				if dbytes, err = json.Marshal(crder.Deprecated); err != nil {
+					errs = append(errs, fileError{Filename: file, Error: err.Error()})
+					continue
+				}
+			}
+			repoCRDs[crd.PrettyGVK(crder.GVK)] = models.RepoCRD{
+				Path:       crd.PrettyGVK(crder.GVK),
+				Filename:   path.Base(file),
+				Group:      crder.GVK.Group,
+				Version:    crder.GVK.Version,
+				Kind:       crder.GVK.Kind,
+				CRD:        cbytes,
+				Warnings:   wbytes,
+				Deprecated: dbytes,
+			}
+		}
+	}
+	return repoCRDs, errs
+}
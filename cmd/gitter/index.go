@@ -0,0 +1,187 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+	"gopkg.in/square/go-jose.v2/json"
+)
+
+const (
+	outputJSON  = "json"
+	outputTable = "table"
+)
+
+// dryRunTag is the dry-run output for a single tag.
+type dryRunTag struct {
+	Tag    string      `json:"tag"`
+	CRDs   []dryRunCRD `json:"crds"`
+	Errors []fileError `json:"errors,omitempty"`
+}
+
+// dryRunCRD is the dry-run output for a single CRD.
+type dryRunCRD struct {
+	Group      string          `json:"group"`
+	Version    string          `json:"version"`
+	Kind       string          `json:"kind"`
+	Filename   string          `json:"filename"`
+	Warnings   json.RawMessage `json:"warnings,omitempty"`
+	Deprecated json.RawMessage `json:"deprecated,omitempty"`
+}
+
+// runIndex runs the index command, which indexes a single repository outside
+// of the RPC server. The output of --dry-run is written to out, and clone
+// progress to stderr, so that JSON output can be parsed.
+func runIndex(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: gitter index <url-or-path> [flags]\n\n")
+		fs.PrintDefaults()
+	}
+	tagName := fs.String("tag", "", "Only index the specified tag.")
+	dryRun := fs.Bool("dry-run", false, "Print discovered CRDs instead of writing them to the database.")
+	output := fs.StringP("output", "o", outputTable, "Output format of --dry-run: json or table.")
+	fs.BoolVar(lenient, "lenient", false, lenientUsage)
+	fs.StringVar(sqlitePath, "sqlite", "", sqliteUsage)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one repository url or path")
+	}
+	src := fs.Arg(0)
+	_, statErr := os.Stat(src)
+	local := statErr == nil
+
+	if !*dryRun {
+		if local {
+			return errors.New("indexing a local path requires --dry-run")
+		}
+		fullRepo, err := normalizeRepo(src)
+		if err != nil {
+			return err
+		}
+		st, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer st.Close()
+		if err := migrateUp(st); err != nil {
+			return err
+		}
+		return (&Gitter{store: st}).index(context.Background(), fullRepo, *tagName, nil)
+	}
+
+	if *output != outputJSON && *output != outputTable {
+		return errors.Errorf("unknown output format %q", *output)
+	}
+	if !local {
+		fullRepo, err := normalizeRepo(src)
+		if err != nil {
+			return err
+		}
+		src = "https://" + fullRepo
+	}
+	res := []dryRunTag{}
+	if err := discover(context.Background(), src, *tagName, func(t tagCRDs) error {
+		d := dryRunTag{Tag: t.name, CRDs: []dryRunCRD{}, Errors: t.errors}
+		for _, c := range t.crds {
+			d.CRDs = append(d.CRDs, dryRunCRD{
+				Group:      c.Group,
+				Version:    c.Version,
+				Kind:       c.Kind,
+				Filename:   c.Filename,
+				Warnings:   c.Warnings,
+				Deprecated: c.Deprecated,
+			})
+		}
+		sort.Slice(d.CRDs, func(i, j int) bool {
+			return d.CRDs[i].Group+"/"+d.CRDs[i].Kind < d.CRDs[j].Group+"/"+d.CRDs[j].Kind
+		})
+		res = append(res, d)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if *output == outputJSON {
+		b, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(b))
+		return err
+	}
+	return printTable(out, res)
+}
+
+func printTable(out io.Writer, res []dryRunTag) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for i := range res {
+		if res[i].Tag == "" {
+			res[i].Tag = "-"
+		}
+	}
+	fmt.Fprintln(w, "TAG\tGROUP\tVERSION\tKIND\tFILENAME")
+	for _, t := range res {
+		for _, c := range t.CRDs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.Tag, c.Group, c.Version, c.Kind, c.Filename)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	var errs []string
+	for _, t := range res {
+		for _, e := range t.Errors {
+			errs = append(errs, fmt.Sprintf("%s\t%s\t%s", t.Tag, e.Filename, e.Error))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(w, "TAG\tFILENAME\tERROR")
+	for _, e := range errs {
+		fmt.Fprintln(w, e)
+	}
+	return w.Flush()
+}
+
+// normalizeRepo converts a repository URL such as
+// https://github.com/org/repo.git to the form github.com/org/repo.
+func normalizeRepo(src string) (string, error) {
+	repo := strings.ToLower(src)
+	for _, prefix := range []string{"https://", "http://"} {
+		repo = strings.TrimPrefix(repo, prefix)
+	}
+	repo = strings.TrimSuffix(strings.TrimSuffix(repo, "/"), ".git")
+	parts := strings.Split(repo, "/")
+	if len(parts) != 3 || parts[0] != "github.com" || parts[1] == "" || parts[2] == "" {
+		return "", errors.Errorf("invalid repository %q: expected github.com/{org}/{repo}", src)
+	}
+	return repo, nil
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// brokenErr is the error reported for config/broken.yaml.
+const brokenErr = "invalid CRD: document 0 (line 1): yaml: line 2: did not find expected node content"
+
+var indexcrd = []byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+  scope: Namespaced
+  names:
+    plural: crontabs
+    kind: CronTab
+`)
+
+func TestNormalizeRepo(t *testing.T) {
+	cases := []struct {
+		name        string
+		src         string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "Plain", src: "github.com/org/repo", expected: "github.com/org/repo"},
+		{name: "HTTPS", src: "https://github.com/Org/Repo.git", expected: "github.com/org/repo"},
+		{name: "TrailingSlash", src: "http://github.com/org/repo/", expected: "github.com/org/repo"},
+		{name: "OtherHost", src: "gitlab.com/org/repo", expectedErr: true},
+		{name: "NoRepo", src: "github.com/org", expectedErr: true},
+		{name: "EmptyOrg", src: "github.com//repo", expectedErr: true},
+		{name: "Subpath", src: "github.com/org/repo/tree/main", expectedErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo, err := normalizeRepo(tc.src)
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("normalizeRepo(%q): got error %v, want error %t", tc.src, err, tc.expectedErr)
+			}
+			if repo != tc.expected {
+				t.Errorf("normalizeRepo(%q): got %q, want %q", tc.src, repo, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRunIndexDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string][]byte{
+		"config/crontab.yaml": indexcrd,
+		"config/broken.yaml":  []byte("kind: CustomResourceDefinition\nspec: [\n"),
+		"README.md":           []byte("kind: CustomResourceDefinition\n"),
+	}
+	for name, b := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name: "JSON",
+			args: []string{dir, "--dry-run", "-o", "json"},
+			expected: `[
+  {
+    "tag": "",
+    "crds": [
+      {
+        "group": "example.com",
+        "version": "v1",
+        "kind": "CronTab",
+        "filename": "crontab.yaml"
+      }
+    ],
+    "errors": [
+      {
+        "filename": "config/broken.yaml",
+        "error": "` + brokenErr + `"
+      }
+    ]
+  }
+]
+`,
+		},
+		{
+			name: "Table",
+			args: []string{dir, "--dry-run"},
+			expected: `TAG  GROUP        VERSION  KIND     FILENAME
+-    example.com  v1       CronTab  crontab.yaml
+
+TAG  FILENAME            ERROR
+-    config/broken.yaml  ` + brokenErr + `
+`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			if err := runIndex(tc.args, out); err != nil {
+				t.Fatalf("runIndex(): %v", err)
+			}
+			if out.String() != tc.expected {
+				t.Errorf("runIndex(): got\n%s\nwant\n%s", out, tc.expected)
+			}
+		})
+	}
+}
@@ -17,283 +17,181 @@ limitations under the License.
 package main
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
-	"net"
 	"net/http"
-	"net/rpc"
 	"os"
-	"path"
-	"regexp"
 	"strings"
 	"time"
 
-	"github.com/crdsdev/doc/pkg/crd"
+	"github.com/crdsdev/doc/pkg/gitter"
 	"github.com/crdsdev/doc/pkg/models"
-	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
-	"github.com/jackc/pgx/v4"
-	"github.com/jackc/pgx/v4/pgxpool"
-	"github.com/pkg/errors"
-	"gopkg.in/square/go-jose.v2/json"
-	yaml "gopkg.in/yaml.v3"
+	"github.com/crdsdev/doc/pkg/store"
+	flag "github.com/spf13/pflag"
 )
 
 const (
-	crdArgCount = 6
-
 	userEnv     = "PG_USER"
 	passwordEnv = "PG_PASS"
 	hostEnv     = "PG_HOST"
 	portEnv     = "PG_PORT"
 	dbEnv       = "PG_DB"
+
+	tokenEnv = "GITTER_TOKEN"
+
+	// recordTimeout is the maximum time to spend recording the metadata and
+	// index of a repo.
+	recordTimeout = 30 * time.Second
+)
+
+var (
+	listen       = flag.String("listen", ":1234", "Address to serve the gitter API on.")
+	workers      = flag.Int("workers", 4, "Number of repos to index concurrently.")
+	tlsCert      = flag.String("tls-cert", "", "Certificate file to serve the gitter API over TLS.")
+	tlsKey       = flag.String("tls-key", "", "Key file to serve the gitter API over TLS.")
+	tlsClientCA  = flag.String("tls-client-ca", "", "CA file used to verify client certificates. If set, clients must present a valid certificate.")
+	indexTimeout = flag.Duration("index-timeout", 30*time.Minute, "Maximum time to spend indexing a single repo.")
+	lenient      = flag.Bool("lenient", false, lenientUsage)
+	sqlitePath   = flag.String("sqlite", "", sqliteUsage)
+	refreshEvery = flag.Duration("refresh-interval", 0, "Reindex all tags of repos whose last index was attempted longer ago than this. Zero disables refreshing.")
+)
+
+const (
+	lenientUsage = "Index CRDs that fail apiserver validation and store their validation errors as warnings."
+	sqliteUsage  = "Path of a SQLite database to use instead of Postgres."
 )
 
 func main() {
-	dsn := fmt.Sprintf("postgresql://%s:%s@%s:%s/%s", os.Getenv(userEnv), os.Getenv(passwordEnv), os.Getenv(hostEnv), os.Getenv(portEnv), os.Getenv(dbEnv))
-	conn, err := pgxpool.ParseConfig(dsn)
+	if len(os.Args) > 1 && os.Args[1] == "index" {
+		if err := runIndex(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	flag.Parse()
+	token := os.Getenv(tokenEnv)
+	if token == "" && (*tlsCert == "" || *tlsClientCA == "") {
+		log.Fatalf("Refusing to serve the gitter API unauthenticated: set %s, or --tls-cert, --tls-key and --tls-client-ca", tokenEnv)
+	}
+	st, err := openStore()
 	if err != nil {
 		panic(err)
 	}
-	pool, err := pgxpool.ConnectConfig(context.Background(), conn)
-	if err != nil {
+	if err := migrateUp(st); err != nil {
 		panic(err)
 	}
-	gitter := &Gitter{
-		conn: pool,
+	g := &Gitter{
+		store: st,
 	}
-	rpc.Register(gitter)
-	rpc.HandleHTTP()
-	l, e := net.Listen("tcp", ":1234")
-	if e != nil {
-		log.Fatal("listen error:", e)
+	s := gitter.NewServer(g.Index, gitter.WithServerToken(token), gitter.WithWorkers(*workers), gitter.WithJobStore(st))
+	go s.Run(context.Background())
+	if *refreshEvery > 0 {
+		go refresh(context.Background(), s, st, *refreshEvery)
+	}
+	srv := &http.Server{
+		Addr:    *listen,
+		Handler: s.Handler(),
 	}
 	log.Println("Starting gitter...")
-	http.Serve(l, nil)
+	if *tlsCert == "" {
+		log.Fatal(srv.ListenAndServe())
+	}
+	if srv.TLSConfig, err = gitter.ServerTLSConfig(*tlsCert, *tlsKey, *tlsClientCA); err != nil {
+		log.Fatal(err)
+	}
+	log.Fatal(srv.ListenAndServeTLS("", ""))
 }
 
-// Gitter indexes git repos.
-type Gitter struct {
-	conn *pgxpool.Pool
+// openStore opens the SQLite database given by --sqlite, or the Postgres
+// database given by the environment.
+func openStore() (store.Store, error) {
+	if *sqlitePath != "" {
+		return store.NewSQLite(*sqlitePath)
+	}
+	dsn := fmt.Sprintf("postgresql://%s:%s@%s:%s/%s", os.Getenv(userEnv), os.Getenv(passwordEnv), os.Getenv(hostEnv), os.Getenv(portEnv), os.Getenv(dbEnv))
+	return store.NewPostgres(context.Background(), dsn)
 }
 
-type tag struct {
-	timestamp time.Time
-	hash      plumbing.Hash
-	name      string
+// Gitter indexes git repos.
+type Gitter struct {
+	store store.Store
 }
 
 // Index indexes a git repo at the specified url.
-func (g *Gitter) Index(gRepo models.GitterRepo, reply *string) error {
-	log.Printf("Indexing repo %s/%s...\n", gRepo.Org, gRepo.Repo)
-
-	dir, err := ioutil.TempDir(os.TempDir(), "doc-gitter")
-	if err != nil {
-		return err
-	}
-	defer os.RemoveAll(dir)
+func (g *Gitter) Index(ctx context.Context, gRepo models.GitterRepo, progress func(gitter.Progress)) error {
+	ctx, cancel := context.WithTimeout(ctx, *indexTimeout)
+	defer cancel()
 	fullRepo := fmt.Sprintf("%s/%s/%s", "github.com", strings.ToLower(gRepo.Org), strings.ToLower(gRepo.Repo))
-	cloneOpts := &git.CloneOptions{
-		URL:               fmt.Sprintf("https://%s", fullRepo),
-		Depth:             1,
-		Progress:          os.Stdout,
-		RecurseSubmodules: git.NoRecurseSubmodules,
-	}
-	if gRepo.Tag != "" {
-		cloneOpts.ReferenceName = plumbing.NewTagReferenceName(gRepo.Tag)
-		cloneOpts.SingleBranch = true
-	}
-	repo, err := git.PlainClone(dir, false, cloneOpts)
-	if err != nil {
-		return err
-	}
-	iter, err := repo.Tags()
-	if err != nil {
-		return err
-	}
-	w, err := repo.Worktree()
-	if err != nil {
-		return err
-	}
-	// Get CRDs for each tag
-	tags := []tag{}
-	if err := iter.ForEach(func(obj *plumbing.Reference) error {
-		if gRepo.Tag == "" {
-			tags = append(tags, tag{
-				hash: obj.Hash(),
-				name: obj.Name().Short(),
-			})
+	return g.index(ctx, fullRepo, gRepo.Tag, progress)
+}
+
+func (g *Gitter) index(ctx context.Context, fullRepo string, tagName string, progress func(gitter.Progress)) error {
+	log.Printf("Indexing repo %s...\n", fullRepo)
+
+	started := time.Now()
+	p := gitter.Progress{}
+	err := discover(ctx, fmt.Sprintf("https://%s", fullRepo), tagName, func(t tagCRDs) error {
+		for _, e := range t.errors {
+			log.Printf("Unable to get CRDs: %s@%s %s (%s)", fullRepo, t.name, e.Filename, e.Error)
+		}
+		if progress != nil {
+			defer func() {
+				p.Tag = t.name
+				p.Tags = t.total
+				p.TagsDone++
+				p.CRDs += len(t.crds)
+				progress(p)
+			}()
+		}
+		if t.commit == nil {
 			return nil
 		}
-		if obj.Name().Short() == gRepo.Tag {
-			tags = append(tags, tag{
-				hash: obj.Hash(),
-				name: obj.Name().Short(),
-			})
-			iter.Close()
-		}
-		return nil
-	}); err != nil {
-		log.Println(err)
-	}
-	for _, t := range tags {
-		h, err := repo.ResolveRevision(plumbing.Revision(t.hash.String()))
-		if err != nil || h == nil {
-			log.Printf("Unable to resolve revision: %s (%v)", t.hash.String(), err)
-			continue
-		}
-		c, err := repo.CommitObject(*h)
-		if err != nil || c == nil {
-			log.Printf("Unable to resolve revision: %s (%v)", t.hash.String(), err)
-			continue
-		}
-		r := g.conn.QueryRow(context.Background(), "SELECT id FROM tags WHERE name=$1 AND repo=$2", t.name, fullRepo)
-		var tagID int
-		if err := r.Scan(&tagID); err != nil {
-			if !errors.Is(err, pgx.ErrNoRows) {
-				return err
-			}
-			r := g.conn.QueryRow(context.Background(), "INSERT INTO tags(name, repo, time) VALUES ($1, $2, $3) RETURNING id", t.name, fullRepo, c.Committer.When)
-			if err := r.Scan(&tagID); err != nil {
-				return err
-			}
-		}
-		repoCRDs, err := getCRDsFromTag(dir, t.name, h, w)
-		if err != nil {
-			log.Printf("Unable to get CRDs: %s@%s (%v)", repo, t.name, err)
-			continue
-		}
-		if len(repoCRDs) > 0 {
-			allArgs := make([]interface{}, 0, len(repoCRDs)*crdArgCount)
-			for _, crd := range repoCRDs {
-				allArgs = append(allArgs, crd.Group, crd.Version, crd.Kind, tagID, crd.Filename, crd.CRD)
-			}
-			if _, err := g.conn.Exec(context.Background(), buildInsert("INSERT INTO crds(\"group\", version, kind, tag_id, filename, data) VALUES ", crdArgCount, len(repoCRDs))+"ON CONFLICT DO NOTHING", allArgs...); err != nil {
-				return err
-			}
+		crds := make([]models.RepoCRD, 0, len(t.crds))
+		for _, c := range t.crds {
+			crds = append(crds, c)
 		}
+		return g.store.AddTag(ctx, fullRepo, t.name, t.commit.Committer.When, crds)
+	})
+	g.record(fullRepo, tagName, started, err)
+	if err != nil {
+		return err
 	}
 
-	log.Printf("Finished indexing %s/%s\n", gRepo.Org, gRepo.Repo)
+	log.Printf("Finished indexing %s\n", fullRepo)
 
 	return nil
 }
 
-func getCRDsFromTag(dir string, tag string, hash *plumbing.Hash, w *git.Worktree) (map[string]models.RepoCRD, error) {
-	err := w.Checkout(&git.CheckoutOptions{
-		Hash:  *hash,
-		Force: true,
-	})
-	if err != nil {
-		return nil, err
-	}
-	if err := w.Reset(&git.ResetOptions{
-		Mode: git.HardReset,
-	}); err != nil {
-		return nil, err
+// record stores the metadata of a repo and, if all of its tags were indexed,
+// the outcome of indexing them. Failures are logged, as the CRDs that were
+// indexed are stored regardless.
+func (g *Gitter) record(fullRepo, tagName string, at time.Time, indexErr error) {
+	if errors.Is(indexErr, context.Canceled) {
+		return
 	}
-	reg := regexp.MustCompile("kind: CustomResourceDefinition")
-	regPath := regexp.MustCompile(`^.*\.yaml`)
-	g, _ := w.Grep(&git.GrepOptions{
-		Patterns:  []*regexp.Regexp{reg},
-		PathSpecs: []*regexp.Regexp{regPath},
-	})
-	repoCRDs := map[string]models.RepoCRD{}
-	files := getYAMLs(g, dir)
-	for file, yamls := range files {
-		for _, y := range yamls {
-			crder, err := crd.NewCRDer(y, crd.StripLabels(), crd.StripAnnotations(), crd.StripConversion())
-			if err != nil || crder.CRD == nil {
-				continue
-			}
-			cbytes, err := json.Marshal(crder.CRD)
-			if err != nil {
-				continue
-			}
-			repoCRDs[crd.PrettyGVK(crder.GVK)] = models.RepoCRD{
-				Path:     crd.PrettyGVK(crder.GVK),
-				Filename: path.Base(file),
-				Group:    crder.GVK.Group,
-				Version:  crder.GVK.Version,
-				Kind:     crder.GVK.Kind,
-				CRD:      cbytes,
-			}
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+	if repo, err := fetchMetadata(ctx, fullRepo); err != nil {
+		log.Printf("Unable to get metadata of %s: %v", fullRepo, err)
+	} else if err := g.store.UpdateRepo(ctx, repo); err != nil {
+		log.Printf("Unable to store metadata of %s: %v", fullRepo, err)
 	}
-	return repoCRDs, nil
-}
-
-func getYAMLs(greps []git.GrepResult, dir string) map[string][][]byte {
-	allCRDs := map[string][][]byte{}
-	for _, res := range greps {
-		b, err := ioutil.ReadFile(dir + "/" + res.FileName)
-		if err != nil {
-			log.Printf("failed to read CRD file: %s", res.FileName)
-			continue
-		}
-
-		yamls, err := splitYAML(b, res.FileName)
-		if err != nil {
-			log.Printf("failed to split/parse CRD file: %s", res.FileName)
-			continue
-		}
-
-		allCRDs[res.FileName] = yamls
+	if tagName != "" {
+		return
 	}
-	return allCRDs
-}
-
-func splitYAML(file []byte, filename string) ([][]byte, error) {
-	var yamls [][]byte
-	var err error = nil
-	defer func() {
-		if err := recover(); err != nil {
-			yamls = make([][]byte, 0)
-			err = fmt.Errorf("panic while processing yaml file: %w", err)
-		}
-	}()
-
-	decoder := yaml.NewDecoder(bytes.NewReader(file))
-	for {
-		var node map[string]interface{}
-		err := decoder.Decode(&node)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			log.Printf("failed to decode part of CRD file: %s\n%s", filename, err)
-			continue
-		}
-
-		doc, err := yaml.Marshal(node)
-		if err != nil {
-			log.Printf("failed to encode part of CRD file: %s\n%s", filename, err)
-			continue
-		}
-		yamls = append(yamls, doc)
+	msg := ""
+	if indexErr != nil {
+		msg = indexErr.Error()
 	}
-	return yamls, err
-}
-
-func buildInsert(query string, argsPerInsert, numInsert int) string {
-	absArg := 1
-	for i := 0; i < numInsert; i++ {
-		query += "("
-		for j := 0; j < argsPerInsert; j++ {
-			query += "$" + fmt.Sprint(absArg)
-			if j != argsPerInsert-1 {
-				query += ","
-			}
-			absArg++
-		}
-		query += ")"
-		if i != numInsert-1 {
-			query += ","
-		}
+	if err := g.store.RecordIndex(ctx, fullRepo, at, msg); err != nil {
+		log.Printf("Unable to record index of %s: %v", fullRepo, err)
 	}
-	return query
 }
@@ -0,0 +1,81 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/crdsdev/doc/pkg/models"
+	"github.com/pkg/errors"
+	"gopkg.in/square/go-jose.v2/json"
+)
+
+const (
+	githubAPI      = "https://api.github.com"
+	githubTokenEnv = "GITHUB_TOKEN"
+)
+
+// githubRepo is the part of a repository returned by the GitHub API that is
+// stored as its metadata.
+type githubRepo struct {
+	DefaultBranch string `json:"default_branch"`
+	Description   string `json:"description"`
+	License       *struct {
+		SPDXID string `json:"spdx_id"`
+	} `json:"license"`
+}
+
+// fetchMetadata gets the metadata of a repo named like github.com/org/repo
+// from the GitHub API, authenticating with GITHUB_TOKEN if it is set.
+func fetchMetadata(ctx context.Context, fullRepo string) (models.Repo, error) {
+	path := strings.TrimPrefix(fullRepo, "github.com/")
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/repos/%s", githubAPI, path), nil)
+	if err != nil {
+		return models.Repo{}, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if token := os.Getenv(githubTokenEnv); token != "" {
+		req.Header.Set("Authorization", "token "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return models.Repo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return models.Repo{}, errors.Errorf("unexpected status %s", resp.Status)
+	}
+	gr := githubRepo{}
+	if err := json.NewDecoder(resp.Body).Decode(&gr); err != nil {
+		return models.Repo{}, err
+	}
+	repo := models.Repo{
+		Name:          fullRepo,
+		DefaultBranch: gr.DefaultBranch,
+		Description:   gr.Description,
+	}
+	// NOASSERTION is reported for licenses that GitHub does not recognize.
+	if gr.License != nil && gr.License.SPDXID != "NOASSERTION" {
+		repo.License = gr.License.SPDXID
+	}
+	return repo, nil
+}
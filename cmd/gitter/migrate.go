@@ -0,0 +1,104 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/crdsdev/doc/pkg/migrate"
+	"github.com/crdsdev/doc/pkg/store"
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+// runMigrate runs the migrate command, which shows or changes the schema
+// version of the database.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: gitter migrate <up|down|status> [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "  up      apply migrations up to --to, or all of them\n")
+		fmt.Fprintf(os.Stderr, "  down    revert migrations down to --to, or the last one\n")
+		fmt.Fprintf(os.Stderr, "  status  print the schema version of the database\n\n")
+		fs.PrintDefaults()
+	}
+	to := fs.Int("to", -1, "Schema version to migrate to.")
+	fs.StringVar(sqlitePath, "sqlite", "", sqliteUsage)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one of up, down or status")
+	}
+	cmd := fs.Arg(0)
+	if cmd != "up" && cmd != "down" && cmd != "status" {
+		fs.Usage()
+		return errors.Errorf("unknown migrate command %q", cmd)
+	}
+
+	ctx := context.Background()
+	st, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	m := st.Migrator()
+	current, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	target := *to
+	switch cmd {
+	case "status":
+		fmt.Printf("schema version %d, latest %d\n", current, m.Latest())
+		return nil
+	case "up":
+		if target < 0 {
+			target = m.Latest()
+		}
+		if target < current {
+			return errors.Errorf("cannot migrate up from %d to %d", current, target)
+		}
+	case "down":
+		if target < 0 {
+			target = current - 1
+		}
+		if target < 0 || target > current {
+			return errors.Errorf("cannot migrate down from %d to %d", current, target)
+		}
+	}
+	steps, err := m.To(ctx, target)
+	logSteps(steps)
+	return err
+}
+
+// migrateUp applies the database migrations that have not been applied.
+func migrateUp(st store.Store) error {
+	steps, err := st.Migrator().Up(context.Background())
+	logSteps(steps)
+	return err
+}
+
+func logSteps(steps []migrate.Step) {
+	for _, s := range steps {
+		log.Printf("Applied migration %s", s)
+	}
+}
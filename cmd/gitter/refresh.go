@@ -0,0 +1,74 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/crdsdev/doc/pkg/gitter"
+	"github.com/crdsdev/doc/pkg/models"
+	"github.com/crdsdev/doc/pkg/store"
+	"github.com/pkg/errors"
+)
+
+const (
+	// refreshCheck is how often repos are checked for a refresh.
+	refreshCheck = 10 * time.Minute
+	// refreshBatch is the maximum number of repos queued for a refresh by
+	// each check, which leaves room in the queue for other jobs.
+	refreshBatch = 16
+)
+
+// refresh queues jobs to index all tags of repos whose last index was
+// attempted more than interval ago, checking every refreshCheck until ctx is
+// done.
+func refresh(ctx context.Context, s *gitter.Server, st store.Store, interval time.Duration) {
+	t := time.NewTicker(refreshCheck)
+	defer t.Stop()
+	for {
+		refreshStale(ctx, s, st, interval)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func refreshStale(ctx context.Context, s *gitter.Server, st store.Store, interval time.Duration) {
+	repos, err := st.StaleRepos(ctx, time.Now().Add(-interval), refreshBatch)
+	if err != nil {
+		log.Printf("Unable to get repos to refresh: %v", err)
+		return
+	}
+	for _, r := range repos {
+		parts := strings.Split(r.Name, "/")
+		if len(parts) != 3 || parts[0] != "github.com" {
+			continue
+		}
+		_, created, err := s.Submit(ctx, models.GitterRepo{Org: parts[1], Repo: parts[2]})
+		if errors.Is(err, gitter.ErrQueueFull) {
+			return
+		}
+		if created {
+			log.Printf("Refreshing repo %s\n", r.Name)
+		}
+	}
+}
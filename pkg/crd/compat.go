@@ -0,0 +1,161 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/validation"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// A KubeVersion is a range of Kubernetes releases and the support of their
+// apiserver for CRD features.
+type KubeVersion struct {
+	Name string
+	// V1Beta1 and V1 are true if CRDs are served at apiextensions.k8s.io
+	// v1beta1 and v1.
+	V1Beta1 bool
+	V1      bool
+	// Defaulting is true if default values in schemas are supported.
+	Defaulting bool
+	// ListType is true if x-kubernetes-list-type and
+	// x-kubernetes-list-map-keys are supported.
+	ListType bool
+	// Deprecation is true if versions may be marked deprecated.
+	Deprecation bool
+}
+
+// KubeVersions are the Kubernetes releases that CRDs are checked against by
+// Compatibility, from the oldest. Each covers the releases up to the next,
+// between which CRD support did not change.
+var KubeVersions = []KubeVersion{
+	{Name: "1.15", V1Beta1: true},
+	{Name: "1.16-1.18", V1Beta1: true, V1: true, Defaulting: true, ListType: true},
+	{Name: "1.19-1.21", V1Beta1: true, V1: true, Defaulting: true, ListType: true, Deprecation: true},
+	{Name: "1.22+", V1: true, Defaulting: true, ListType: true, Deprecation: true},
+}
+
+// CompatLevel is how well a CRD is supported by a Kubernetes release.
+type CompatLevel string
+
+const (
+	// Compatible CRDs are fully supported.
+	Compatible CompatLevel = "Compatible"
+	// Degraded CRDs can be installed, but some of their features are ignored.
+	Degraded CompatLevel = "Degraded"
+	// Incompatible CRDs cannot be installed.
+	Incompatible CompatLevel = "Incompatible"
+)
+
+// Compat is the support of a CRD by a Kubernetes release. Reasons explain a
+// level other than Compatible.
+type Compat struct {
+	KubeVersion string      `json:"kubeVersion"`
+	Level       CompatLevel `json:"level"`
+	Reasons     []string    `json:"reasons,omitempty"`
+}
+
+// degrade lowers the level of c to l, if it is higher, and adds reason.
+func (c *Compat) degrade(l CompatLevel, reason string) {
+	if c.Level != Incompatible {
+		c.Level = l
+	}
+	c.Reasons = append(c.Reasons, reason)
+}
+
+// Compatibility checks the CRD against each of KubeVersions. A CRD can be
+// installed on a release if it is valid as an API version of CRDs that the
+// release serves, regardless of the API version it was written in, as the
+// manifest can be converted. Deprecated holds the deprecated versions of the
+// CRD, as in CRDer, as the internal CRD type does not carry them.
+func Compatibility(crd *apiextensions.CustomResourceDefinition, deprecated map[string]string) []Compat {
+	validV1Beta1 := validAs(crd, v1beta1.SchemeGroupVersion)
+	validV1 := validAs(crd, v1.SchemeGroupVersion)
+	defaults := usesSchemaField(crd, func(s *apiextensions.JSONSchemaProps) bool {
+		return s.Default != nil
+	})
+	listTypes := usesSchemaField(crd, func(s *apiextensions.JSONSchemaProps) bool {
+		return s.XListType != nil || len(s.XListMapKeys) > 0
+	})
+
+	compat := make([]Compat, 0, len(KubeVersions))
+	for _, kv := range KubeVersions {
+		c := Compat{KubeVersion: kv.Name, Level: Compatible}
+		switch {
+		case (kv.V1Beta1 && validV1Beta1) || (kv.V1 && validV1):
+		case !kv.V1Beta1 && validV1Beta1:
+			c.degrade(Incompatible, fmt.Sprintf("%s is not served and the CRD is not valid as %s", v1beta1.SchemeGroupVersion, v1.SchemeGroupVersion))
+		case !kv.V1 && validV1:
+			c.degrade(Incompatible, fmt.Sprintf("%s is not served and the CRD is not valid as %s", v1.SchemeGroupVersion, v1beta1.SchemeGroupVersion))
+		default:
+			c.degrade(Incompatible, fmt.Sprintf("the CRD is not valid as %s", strings.Join(servedVersions(kv), " or ")))
+		}
+		if defaults && !kv.Defaulting {
+			c.degrade(Incompatible, "default values are not supported")
+		}
+		if listTypes && !kv.ListType {
+			c.degrade(Degraded, "x-kubernetes-list-type and x-kubernetes-list-map-keys are ignored")
+		}
+		if len(deprecated) > 0 && !kv.Deprecation {
+			c.degrade(Degraded, "deprecated versions are not reported to clients")
+		}
+		compat = append(compat, c)
+	}
+	return compat
+}
+
+// validAs returns true if the CRD passes the validation of the apiserver for
+// gv. Problems with labels, annotations and webhook client configuration are
+// ignored, as they may have been stripped when the CRD was indexed.
+func validAs(crd *apiextensions.CustomResourceDefinition, gv schema.GroupVersion) bool {
+	for _, err := range validation.ValidateCustomResourceDefinition(withoutWebhook(crd), gv) {
+		if !strings.HasPrefix(err.Field, "metadata.") {
+			return false
+		}
+	}
+	return true
+}
+
+// usesSchemaField returns true if match returns true for the root or any
+// field of a schema of the CRD.
+func usesSchemaField(crd *apiextensions.CustomResourceDefinition, match func(s *apiextensions.JSONSchemaProps) bool) bool {
+	found := false
+	for _, vs := range versionSchemas(crd) {
+		found = found || match(vs.schema)
+		walkSchema("", vs.schema, func(_ string, s *apiextensions.JSONSchemaProps, _ bool) {
+			found = found || match(s)
+		})
+	}
+	return found
+}
+
+// servedVersions returns the API versions of CRDs served by kv.
+func servedVersions(kv KubeVersion) []string {
+	var served []string
+	if kv.V1Beta1 {
+		served = append(served, v1beta1.SchemeGroupVersion.String())
+	}
+	if kv.V1 {
+		served = append(served, v1.SchemeGroupVersion.String())
+	}
+	return served
+}
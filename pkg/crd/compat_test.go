@@ -0,0 +1,111 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"reflect"
+	"testing"
+)
+
+var compatcrd = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              replicas:
+                type: integer
+                default: 1
+              hosts:
+                type: array
+                x-kubernetes-list-type: set
+                items:
+                  type: string
+  - name: v1beta1
+    served: true
+    storage: false
+    deprecated: true
+    schema:
+      openAPIV3Schema:
+        type: object
+  scope: Namespaced
+  names:
+    plural: crontabs
+    kind: CronTab
+`)
+
+func TestCompatibility(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		want []Compat
+	}{
+		{
+			name: "V1Beta1",
+			data: nonstructuralcrd,
+			want: []Compat{
+				{KubeVersion: "1.15", Level: Compatible},
+				{KubeVersion: "1.16-1.18", Level: Compatible},
+				{KubeVersion: "1.19-1.21", Level: Compatible},
+				{KubeVersion: "1.22+", Level: Incompatible, Reasons: []string{
+					"apiextensions.k8s.io/v1beta1 is not served and the CRD is not valid as apiextensions.k8s.io/v1",
+				}},
+			},
+		},
+		{
+			name: "V1Features",
+			data: compatcrd,
+			want: []Compat{
+				{KubeVersion: "1.15", Level: Incompatible, Reasons: []string{
+					"apiextensions.k8s.io/v1 is not served and the CRD is not valid as apiextensions.k8s.io/v1beta1",
+					"default values are not supported",
+					"x-kubernetes-list-type and x-kubernetes-list-map-keys are ignored",
+					"deprecated versions are not reported to clients",
+				}},
+				{KubeVersion: "1.16-1.18", Level: Degraded, Reasons: []string{
+					"deprecated versions are not reported to clients",
+				}},
+				{KubeVersion: "1.19-1.21", Level: Compatible},
+				{KubeVersion: "1.22+", Level: Compatible},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewCRDer(tc.data)
+			if err != nil {
+				t.Fatalf("Failed to create CRDer: %s", err)
+			}
+			got := Compatibility(c.CRD, c.Deprecated)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Compatibility() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
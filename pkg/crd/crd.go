@@ -22,6 +22,8 @@ import (
 	"fmt"
 
 	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	structuraldefaulting "k8s.io/apiextensions-apiserver/pkg/apiserver/schema/defaulting"
 	servervalidation "k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -39,12 +41,24 @@ const (
 	getTypeMetaErr           = "could not get type metadata for crd instance"
 	wrongGVKErr              = "crd instance was not of correct group version kind"
 	instanceConversionErr    = "could not convert crd instance json to instance"
+	noSchemaErr              = "crd has no schema"
+	structuralSchemaErr      = "crd schema is not structural"
+	unservedVersionErr       = "crd instance version is not served"
 )
 
 // CRDer generates instances of a CustomResourceDefinition.
 type CRDer struct {
 	CRD *apiextensions.CustomResourceDefinition
 	GVK *schema.GroupVersionKind
+
+	// Deprecated maps the names of deprecated versions to their deprecation
+	// warnings. The internal CRD type does not carry deprecation, so it is
+	// read from the manifest by NewCRDer.
+	Deprecated map[string]string
+
+	// Warnings are the validation errors of a CRD that was accepted by
+	// NewLenientCRDer despite failing validation.
+	Warnings []*FieldError
 }
 
 // NewCRDer returns a new CRDer type.
@@ -52,7 +66,9 @@ func NewCRDer(data []byte, m ...Modifier) (*CRDer, error) {
 	internal := &apiextensions.CustomResourceDefinition{}
 	if errV1Beta1 := convertV1Beta1ToInternal(data, internal, m...); errV1Beta1 != nil {
 		if errV1 := convertV1ToInternal(data, internal, m...); errV1 != nil {
-			return nil, fmt.Errorf("conversion unsuccessful: %s, %s", errV1Beta1, errV1)
+			meta := &metav1.TypeMeta{}
+			_ = yaml.Unmarshal(data, meta)
+			return nil, &ConversionError{APIVersion: meta.APIVersion, V1Beta1: errV1Beta1, V1: errV1}
 		}
 	}
 
@@ -61,42 +77,133 @@ func NewCRDer(data []byte, m ...Modifier) (*CRDer, error) {
 		return nil, errors.New(getStoredGVKErr)
 	}
 
-	return &CRDer{CRD: internal, GVK: gvk}, nil
+	return &CRDer{CRD: internal, GVK: gvk, Deprecated: getDeprecatedVersions(data, gvk)}, nil
+}
+
+// NewLenientCRDer returns a new CRDer type for a CRD that may not pass the
+// validation of the apiserver, as is common in older releases of projects. The
+// CRD is converted from the API version that it declares and its validation
+// errors are returned as the Warnings of the CRDer. An error is returned if
+// the CRD cannot be converted or has no storage version.
+func NewLenientCRDer(data []byte, m ...Modifier) (*CRDer, error) {
+	c, err := NewCRDer(data, m...)
+	var cerr *ConversionError
+	if !errors.As(err, &cerr) {
+		return c, err
+	}
+	convert := convertV1ToInternal
+	if cerr.APIVersion == v1beta1.SchemeGroupVersion.String() {
+		convert = convertV1Beta1ToInternal
+	}
+	internal := &apiextensions.CustomResourceDefinition{}
+	var verr *ValidationError
+	if !errors.As(convert(data, internal, m...), &verr) {
+		return nil, err
+	}
+	gvk := GetStoredGVK(internal)
+	if gvk == nil {
+		return nil, err
+	}
+	return &CRDer{CRD: internal, GVK: gvk, Deprecated: getDeprecatedVersions(data, gvk), Warnings: verr.Errors}, nil
 }
 
-// Validate returns true if CRD instance is valid.
+// Validate returns an error if the CRD instance is not valid against the
+// schema of the version it declares. If the instance could be checked, the
+// error is a *ValidationError holding every problem found.
 func (c *CRDer) Validate(data []byte) error {
-	sv := getStoredSchema(c.CRD.Spec)
+	instance, version, err := c.decode(data)
+	if err != nil {
+		return err
+	}
 
-	s, _, err := servervalidation.NewSchemaValidator(sv)
+	s, _, err := servervalidation.NewSchemaValidator(getVersionSchema(c.CRD.Spec, version))
 	if err != nil {
 		return errors.New(createSchemaValidatorErr)
 	}
+	if s == nil {
+		return nil
+	}
+	return newValidationError(s.Validate(instance), instance)
+}
+
+// DeprecationWarnings returns the warnings that the apiserver sends for the
+// CRD instance, which are those of the version it declares if the version is
+// deprecated.
+func (c *CRDer) DeprecationWarnings(data []byte) ([]string, error) {
+	_, version, err := c.decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if w, ok := c.Deprecated[version]; ok {
+		return []string{w}, nil
+	}
+	return nil, nil
+}
 
+// Default returns the CRD instance with the default values from the schema
+// of its version applied, as the apiserver does when an instance is read or
+// written.
+func (c *CRDer) Default(data []byte) (map[string]interface{}, error) {
+	instance, version, err := c.decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := getStructuralSchema(c.CRD.Spec, version)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, ok := instance.(map[string]interface{})
+	if !ok {
+		return nil, errors.New(instanceConversionErr)
+	}
+	structuraldefaulting.Default(obj, s)
+	return obj, nil
+}
+
+// decode converts a YAML or JSON CRD instance to its unstructured form and
+// returns the version that it declares, ensuring that it is of the correct
+// group and kind, and of a served version.
+func (c *CRDer) decode(data []byte) (interface{}, string, error) {
 	j, err := yaml.YAMLToJSONStrict(data)
 	if err != nil {
-		return errors.New(yamlToJSONErr)
+		return nil, "", errors.New(yamlToJSONErr)
 	}
 
 	meta := &metav1.TypeMeta{}
 	if err := json.Unmarshal(j, meta); err != nil {
-		return errors.New(getTypeMetaErr)
+		return nil, "", errors.New(getTypeMetaErr)
 	}
 
-	if !isStoredGVK(meta, c.GVK) {
-		return errors.New(wrongGVKErr)
+	v, err := c.getVersion(meta)
+	if err != nil {
+		return nil, "", err
 	}
 
 	var instance interface{}
 	if err := json.Unmarshal(j, &instance); err != nil {
-		return errors.New(instanceConversionErr)
+		return nil, "", errors.New(instanceConversionErr)
 	}
+	return instance, v.Name, nil
+}
 
-	res := servervalidation.ValidateCustomResource(nil, instance, s)
-	if len(res) > 0 {
-		return errors.New(res.ToAggregate().Error())
+// getVersion returns the served version of the CRD that meta refers to.
+func (c *CRDer) getVersion(meta *metav1.TypeMeta) (*apiextensions.CustomResourceDefinitionVersion, error) {
+	gvk := meta.GroupVersionKind()
+	if gvk.Group != c.CRD.Spec.Group || gvk.Kind != c.CRD.Spec.Names.Kind {
+		return nil, errors.New(wrongGVKErr)
 	}
-	return nil
+	for i, v := range c.CRD.Spec.Versions {
+		if v.Name != gvk.Version {
+			continue
+		}
+		if !v.Served {
+			return nil, fmt.Errorf("%s: %s", unservedVersionErr, v.Name)
+		}
+		return &c.CRD.Spec.Versions[i], nil
+	}
+	return nil, errors.New(wrongGVKErr)
 }
 
 func convertV1ToInternal(data []byte, internal *apiextensions.CustomResourceDefinition, mods ...Modifier) error {
@@ -111,12 +218,7 @@ func convertV1ToInternal(data []byte, internal *apiextensions.CustomResourceDefi
 	for _, m := range mods {
 		m(internal)
 	}
-	errList := validation.ValidateCustomResourceDefinition(internal, v1.SchemeGroupVersion)
-	if len(errList) > 0 {
-		return errors.New(errList.ToAggregate().Error())
-	}
-
-	return nil
+	return newFieldListError(validation.ValidateCustomResourceDefinition(withoutWebhook(internal), v1.SchemeGroupVersion))
 }
 
 func convertV1Beta1ToInternal(data []byte, internal *apiextensions.CustomResourceDefinition, mods ...Modifier) error {
@@ -131,26 +233,89 @@ func convertV1Beta1ToInternal(data []byte, internal *apiextensions.CustomResourc
 	for _, m := range mods {
 		m(internal)
 	}
-	errList := validation.ValidateCustomResourceDefinition(internal, v1beta1.SchemeGroupVersion)
-	if len(errList) > 0 {
-		return errors.New(errList.ToAggregate().Error())
-	}
+	return newFieldListError(validation.ValidateCustomResourceDefinition(withoutWebhook(internal), v1beta1.SchemeGroupVersion))
+}
 
-	return nil
+// withoutWebhook returns crd with webhook conversion replaced by no conversion.
+// A conversion webhook refers to a service in the cluster the CRD is installed
+// in, so it is documented as is rather than validated.
+func withoutWebhook(crd *apiextensions.CustomResourceDefinition) *apiextensions.CustomResourceDefinition {
+	if crd.Spec.Conversion == nil || crd.Spec.Conversion.Strategy != apiextensions.WebhookConverter {
+		return crd
+	}
+	c := crd.DeepCopy()
+	c.Spec.Conversion = &apiextensions.CustomResourceConversion{Strategy: apiextensions.NoneConverter}
+	return c
 }
 
-func getStoredSchema(spec apiextensions.CustomResourceDefinitionSpec) *apiextensions.CustomResourceValidation {
+// getVersionSchema returns the schema of the named version, or the schema
+// shared by all versions if there is one.
+func getVersionSchema(spec apiextensions.CustomResourceDefinitionSpec, version string) *apiextensions.CustomResourceValidation {
 	if spec.Validation != nil {
 		return spec.Validation
 	}
 	for _, v := range spec.Versions {
-		if v.Storage {
+		if v.Name == version {
 			return v.Schema
 		}
 	}
 	return nil
 }
 
+func hasVersion(spec apiextensions.CustomResourceDefinitionSpec, version string) bool {
+	for _, v := range spec.Versions {
+		if v.Name == version {
+			return true
+		}
+	}
+	return false
+}
+
+func getStructuralSchema(spec apiextensions.CustomResourceDefinitionSpec, version string) (*structuralschema.Structural, error) {
+	sv := getVersionSchema(spec, version)
+	if sv == nil || sv.OpenAPIV3Schema == nil {
+		return nil, errors.New(noSchemaErr)
+	}
+	s, err := structuralschema.NewStructural(sv.OpenAPIV3Schema)
+	if err != nil {
+		return nil, errors.New(structuralSchemaErr)
+	}
+	return s, nil
+}
+
+// getDeprecatedVersions returns the deprecation warnings of the deprecated
+// versions of a v1 CRD manifest. A default warning is used for versions that
+// do not specify one.
+func getDeprecatedVersions(data []byte, gvk *schema.GroupVersionKind) map[string]string {
+	crd := struct {
+		Spec struct {
+			Versions []struct {
+				Name               string  `json:"name"`
+				Deprecated         bool    `json:"deprecated"`
+				DeprecationWarning *string `json:"deprecationWarning"`
+			} `json:"versions"`
+		} `json:"spec"`
+	}{}
+	if err := yaml.Unmarshal(data, &crd); err != nil {
+		return nil
+	}
+	var deprecated map[string]string
+	for _, v := range crd.Spec.Versions {
+		if !v.Deprecated {
+			continue
+		}
+		if deprecated == nil {
+			deprecated = map[string]string{}
+		}
+		if v.DeprecationWarning != nil {
+			deprecated[v.Name] = *v.DeprecationWarning
+			continue
+		}
+		deprecated[v.Name] = fmt.Sprintf("%s/%s %s is deprecated", gvk.Group, v.Name, gvk.Kind)
+	}
+	return deprecated
+}
+
 func GetStoredGVK(crd *apiextensions.CustomResourceDefinition) *schema.GroupVersionKind {
 	for _, v := range crd.Spec.Versions {
 		if v.Storage {
@@ -165,12 +330,32 @@ func GetStoredGVK(crd *apiextensions.CustomResourceDefinition) *schema.GroupVers
 	return nil
 }
 
-func isStoredGVK(meta *metav1.TypeMeta, gvk *schema.GroupVersionKind) bool {
-	if meta.GroupVersionKind() == *gvk {
-		return true
+// GetVersionSubresources returns the subresources of the named version of a
+// CRD, or nil if it has none.
+func GetVersionSubresources(crd *apiextensions.CustomResourceDefinition, version string) *apiextensions.CustomResourceSubresources {
+	if crd.Spec.Subresources != nil {
+		return crd.Spec.Subresources
 	}
+	for _, v := range crd.Spec.Versions {
+		if v.Name == version {
+			return v.Subresources
+		}
+	}
+	return nil
+}
 
-	return false
+// GetVersionPrinterColumns returns the additional printer columns of the
+// named version of a CRD.
+func GetVersionPrinterColumns(crd *apiextensions.CustomResourceDefinition, version string) []apiextensions.CustomResourceColumnDefinition {
+	if len(crd.Spec.AdditionalPrinterColumns) > 0 {
+		return crd.Spec.AdditionalPrinterColumns
+	}
+	for _, v := range crd.Spec.Versions {
+		if v.Name == version {
+			return v.AdditionalPrinterColumns
+		}
+	}
+	return nil
 }
 
 // A Modifier specifies how to modify a CRD prior to conversion to internal
@@ -198,6 +383,34 @@ func StripConversion() Modifier {
 	}
 }
 
+// RedactConversion removes the client config of a CRD's conversion webhook,
+// which refers to a service or URL of the cluster the CRD is installed in. The
+// conversion strategy and review versions are kept, so CRDs read with it must
+// be passed to WithoutRedactedWebhook before they are written as manifests.
+func RedactConversion() Modifier {
+	return func(crd *apiextensions.CustomResourceDefinition) {
+		if crd.Spec.Conversion != nil {
+			crd.Spec.Conversion.WebhookClientConfig = nil
+		}
+	}
+}
+
+// WithoutRedactedWebhook returns the CRD with its conversion strategy set to
+// None if it converts with a webhook whose client config was removed, as by
+// RedactConversion, and true. A webhook without a client config fails the
+// validation of the apiserver, as does any webhook when
+// spec.preserveUnknownFields is true, so manifests written from stored CRDs
+// must not have one. Other CRDs are returned as they are, and false.
+func WithoutRedactedWebhook(crd *apiextensions.CustomResourceDefinition) (*apiextensions.CustomResourceDefinition, bool) {
+	conv := crd.Spec.Conversion
+	if conv == nil || conv.Strategy != apiextensions.WebhookConverter || conv.WebhookClientConfig != nil {
+		return crd, false
+	}
+	c := crd.DeepCopy()
+	c.Spec.Conversion = &apiextensions.CustomResourceConversion{Strategy: apiextensions.NoneConverter}
+	return c, true
+}
+
 // PrettyGVK returns a group, version, kind representation in order of
 // specificity.
 func PrettyGVK(gvk *schema.GroupVersionKind) string {
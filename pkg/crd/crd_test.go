@@ -17,12 +17,17 @@ limitations under the License.
 package crd
 
 import (
+	"reflect"
 	"testing"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	"sigs.k8s.io/yaml"
 )
 
 var _ Modifier = StripLabels()
 var _ Modifier = StripAnnotations()
 var _ Modifier = StripConversion()
+var _ Modifier = RedactConversion()
 
 var v1crd = []byte(`
 apiVersion: apiextensions.k8s.io/v1
@@ -381,3 +386,389 @@ func TestValidate(t *testing.T) {
 		})
 	}
 }
+
+var multiversion = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    subresources:
+      status: {}
+    additionalPrinterColumns:
+    - name: Spec
+      type: string
+      jsonPath: .spec.cronSpec
+    schema:
+      openAPIV3Schema:
+        type: object
+        required:
+        - spec
+        properties:
+          spec:
+            type: object
+            required:
+            - cronSpec
+            properties:
+              cronSpec:
+                type: string
+  - name: v1beta1
+    served: true
+    storage: false
+    deprecated: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            required:
+            - schedule
+            properties:
+              schedule:
+                type: string
+  - name: v1alpha1
+    served: false
+    storage: false
+    schema:
+      openAPIV3Schema:
+        type: object
+  scope: Namespaced
+  names:
+    plural: crontabs
+    singular: crontab
+    kind: CronTab
+`)
+
+var v1beta1Instance = []byte(`
+apiVersion: example.com/v1beta1
+kind: CronTab
+metadata:
+  name: my-new-cron-object
+spec:
+  schedule: "* * * * */5"
+`)
+
+var v1alpha1Instance = []byte(`
+apiVersion: example.com/v1alpha1
+kind: CronTab
+metadata:
+  name: my-new-cron-object
+`)
+
+func TestValidateVersions(t *testing.T) {
+	cases := []struct {
+		name             string
+		instance         []byte
+		expectedWarnings []string
+		expectedErr      bool
+	}{
+		{
+			name:        "storage version invalid",
+			instance:    a,
+			expectedErr: true,
+		},
+		{
+			name:             "deprecated version valid",
+			instance:         v1beta1Instance,
+			expectedWarnings: []string{"example.com/v1beta1 CronTab is deprecated"},
+		},
+		{
+			name:        "unserved version",
+			instance:    v1alpha1Instance,
+			expectedErr: true,
+		},
+		{
+			name:        "wrong kind",
+			instance:    b,
+			expectedErr: true,
+		},
+	}
+
+	c, err := NewCRDer(multiversion)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := c.Validate(tc.instance)
+			if err != nil && !tc.expectedErr {
+				t.Errorf("Unexpected validation error: %s", err)
+			}
+			if err == nil && tc.expectedErr {
+				t.Error("Expected validation error")
+			}
+			warnings, _ := c.DeprecationWarnings(tc.instance)
+			if !reflect.DeepEqual(warnings, tc.expectedWarnings) {
+				t.Errorf("Expected warnings %v, got %v", tc.expectedWarnings, warnings)
+			}
+		})
+	}
+}
+
+var defaultcrd = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              schedule:
+                type: string
+                default: "* * * * *"
+              replicas:
+                type: integer
+                default: 1
+              template:
+                type: object
+                default: {}
+                properties:
+                  image:
+                    type: string
+                    default: busybox
+              containers:
+                type: array
+                items:
+                  type: object
+                  properties:
+                    name:
+                      type: string
+                    pullPolicy:
+                      type: string
+                      default: IfNotPresent
+  scope: Namespaced
+  names:
+    plural: crontabs
+    singular: crontab
+    kind: CronTab
+`)
+
+var c = []byte(`
+apiVersion: example.com/v1
+kind: CronTab
+metadata:
+  name: my-new-cron-object
+spec:
+  replicas: 3
+  containers:
+  - name: a
+  - name: b
+    pullPolicy: Always
+`)
+
+func TestDefault(t *testing.T) {
+	cases := []struct {
+		name        string
+		crd         []byte
+		instance    []byte
+		expected    string
+		expectedErr bool
+	}{
+		{
+			name:     "nested defaults",
+			crd:      defaultcrd,
+			instance: c,
+			expected: `apiVersion: example.com/v1
+kind: CronTab
+metadata:
+  name: my-new-cron-object
+spec:
+  containers:
+  - name: a
+    pullPolicy: IfNotPresent
+  - name: b
+    pullPolicy: Always
+  replicas: 3
+  schedule: '* * * * *'
+  template:
+    image: busybox
+`,
+		},
+		{
+			name:        "wrong gvk",
+			crd:         defaultcrd,
+			instance:    b,
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewCRDer(tc.crd)
+			if err != nil {
+				t.Fatalf("Failed to create CRDer: %s", err)
+			}
+			obj, err := c.Default(tc.instance)
+			if err != nil {
+				if !tc.expectedErr {
+					t.Errorf("Unexpected defaulting error: %s", err)
+				}
+				return
+			}
+			if tc.expectedErr {
+				t.Fatal("Expected defaulting error")
+			}
+			y, err := yaml.Marshal(obj)
+			if err != nil {
+				t.Fatalf("Failed to marshal defaulted object: %s", err)
+			}
+			if string(y) != tc.expected {
+				t.Errorf("Expected defaulted object:\n%s\ngot:\n%s", tc.expected, y)
+			}
+		})
+	}
+}
+
+func TestVersionDetails(t *testing.T) {
+	c, err := NewCRDer(multiversion)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	if s := GetVersionSubresources(c.CRD, "v1"); s == nil || s.Status == nil || s.Scale != nil {
+		t.Errorf("Expected v1 to have only the status subresource, got %+v", s)
+	}
+	if s := GetVersionSubresources(c.CRD, "v1beta1"); s != nil {
+		t.Errorf("Expected v1beta1 to have no subresources, got %+v", s)
+	}
+	expected := []apiextensions.CustomResourceColumnDefinition{{Name: "Spec", Type: "string", JSONPath: ".spec.cronSpec"}}
+	if cols := GetVersionPrinterColumns(c.CRD, "v1"); !reflect.DeepEqual(cols, expected) {
+		t.Errorf("Expected v1 printer columns %+v, got %+v", expected, cols)
+	}
+	if cols := GetVersionPrinterColumns(c.CRD, "v1beta1"); len(cols) != 0 {
+		t.Errorf("Expected v1beta1 to have no printer columns, got %+v", cols)
+	}
+}
+
+var webhookcrd = []byte(`
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  version: v1
+  scope: Namespaced
+  names:
+    plural: crontabs
+    kind: CronTab
+  conversion:
+    strategy: Webhook
+    conversionReviewVersions:
+    - v1beta1
+    webhookClientConfig:
+      service:
+        namespace: system
+        name: webhook-service
+        path: /convert
+`)
+
+func TestConversion(t *testing.T) {
+	cases := []struct {
+		name     string
+		mods     []Modifier
+		expected *apiextensions.CustomResourceConversion
+	}{
+		{
+			name: "webhook",
+			expected: &apiextensions.CustomResourceConversion{
+				Strategy:                 apiextensions.WebhookConverter,
+				ConversionReviewVersions: []string{"v1beta1"},
+				WebhookClientConfig: &apiextensions.WebhookClientConfig{
+					Service: &apiextensions.ServiceReference{Namespace: "system", Name: "webhook-service", Path: stringPtr("/convert"), Port: 443},
+				},
+			},
+		},
+		{
+			name: "redacted",
+			mods: []Modifier{RedactConversion()},
+			expected: &apiextensions.CustomResourceConversion{
+				Strategy:                 apiextensions.WebhookConverter,
+				ConversionReviewVersions: []string{"v1beta1"},
+			},
+		},
+		{
+			name: "stripped",
+			mods: []Modifier{StripConversion()},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewCRDer(webhookcrd, tc.mods...)
+			if err != nil {
+				t.Fatalf("Failed to create CRDer: %s", err)
+			}
+			if !reflect.DeepEqual(c.CRD.Spec.Conversion, tc.expected) {
+				t.Errorf("Expected conversion %+v, got %+v", tc.expected, c.CRD.Spec.Conversion)
+			}
+		})
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+var misnamedcrd = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontab.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+  scope: Namespaced
+  names:
+    plural: crontabs
+    kind: CronTab
+`)
+
+func TestNewLenientCRDer(t *testing.T) {
+	if _, err := NewCRDer(misnamedcrd); err == nil {
+		t.Fatal("Expected misnamed CRD to fail validation")
+	}
+	c, err := NewLenientCRDer(misnamedcrd)
+	if err != nil {
+		t.Fatalf("Failed to create lenient CRDer: %s", err)
+	}
+	if c.GVK.Kind != "CronTab" || c.GVK.Version != "v1" {
+		t.Errorf("Unexpected GVK %s", PrettyGVK(c.GVK))
+	}
+	if len(c.Warnings) != 1 || c.Warnings[0].Field != "metadata.name" {
+		t.Errorf("Expected a single metadata.name warning, got %v", c.Warnings)
+	}
+
+	c, err = NewLenientCRDer(v1crd)
+	if err != nil {
+		t.Fatalf("Failed to create lenient CRDer: %s", err)
+	}
+	if len(c.Warnings) != 0 {
+		t.Errorf("Expected no warnings for a valid CRD, got %v", c.Warnings)
+	}
+
+	if _, err := NewLenientCRDer([]byte("kind: CustomResourceDefinition\nspec: 1")); err == nil {
+		t.Error("Expected error for a CRD that cannot be converted")
+	}
+}
@@ -0,0 +1,417 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+// ChangeType is the kind of change made to a schema.
+type ChangeType string
+
+// Types of schema changes.
+const (
+	FieldAdded                  ChangeType = "FieldAdded"
+	FieldRemoved                ChangeType = "FieldRemoved"
+	TypeChanged                 ChangeType = "TypeChanged"
+	RequiredAdded               ChangeType = "RequiredAdded"
+	RequiredRemoved             ChangeType = "RequiredRemoved"
+	EnumValueAdded              ChangeType = "EnumValueAdded"
+	EnumValueRemoved            ChangeType = "EnumValueRemoved"
+	ConstraintChanged           ChangeType = "ConstraintChanged"
+	DefaultChanged              ChangeType = "DefaultChanged"
+	DescriptionChanged          ChangeType = "DescriptionChanged"
+	SubschemaAdded              ChangeType = "SubschemaAdded"
+	SubschemaRemoved            ChangeType = "SubschemaRemoved"
+	ExtensionChanged            ChangeType = "ExtensionChanged"
+	AdditionalPropertiesChanged ChangeType = "AdditionalPropertiesChanged"
+)
+
+// Severity is the impact of a schema change on existing clients and stored
+// objects.
+type Severity string
+
+// Severities of schema changes, in increasing order of impact.
+const (
+	// SeverityInfo changes are backwards compatible.
+	SeverityInfo Severity = "Info"
+	// SeverityWarning changes may be breaking depending on usage.
+	SeverityWarning Severity = "Warning"
+	// SeverityBreaking changes may reject or prune previously valid objects.
+	SeverityBreaking Severity = "Breaking"
+)
+
+// A Change is a single difference between two schemas. Path is the dotted
+// path of the changed field, where [] denotes array items and * denotes
+// additionalProperties. For ConstraintChanged and ExtensionChanged,
+// Constraint is the schema keyword that changed, such as maximum or
+// x-kubernetes-list-type, and Path is the field it applies to. Old and New
+// are nil if the value was not set.
+type Change struct {
+	Path       string
+	Constraint string
+	Type       ChangeType
+	Old        interface{}
+	New        interface{}
+	Severity   Severity
+}
+
+func (c Change) String() string {
+	path := c.Path
+	if c.Constraint != "" {
+		path = fmt.Sprintf("%s (%s)", c.Path, c.Constraint)
+	}
+	return fmt.Sprintf("%s %s: %v -> %v (%s)", path, c.Type, c.Old, c.New, c.Severity)
+}
+
+// Diff returns the changes required to go from the old schema to the new one,
+// ordered by path.
+func Diff(old, new *apiextensions.JSONSchemaProps) []Change {
+	d := &differ{}
+	d.schema("", old, new)
+	sort.SliceStable(d.changes, func(i, j int) bool {
+		return d.changes[i].Path < d.changes[j].Path
+	})
+	return d.changes
+}
+
+// IsBreaking returns true if any change is breaking.
+func IsBreaking(changes []Change) bool {
+	for _, c := range changes {
+		if c.Severity == SeverityBreaking {
+			return true
+		}
+	}
+	return false
+}
+
+type differ struct {
+	changes []Change
+}
+
+func (d *differ) add(path string, t ChangeType, old, new interface{}, s Severity) {
+	d.changes = append(d.changes, Change{Path: path, Type: t, Old: old, New: new, Severity: s})
+}
+
+func (d *differ) addConstraint(path, constraint string, t ChangeType, old, new interface{}, s Severity) {
+	d.changes = append(d.changes, Change{Path: path, Constraint: constraint, Type: t, Old: old, New: new, Severity: s})
+}
+
+func (d *differ) schema(path string, old, new *apiextensions.JSONSchemaProps) {
+	switch {
+	case old == nil && new == nil:
+		return
+	case old == nil:
+		d.add(path, SubschemaAdded, nil, new.Type, SeverityWarning)
+		return
+	case new == nil:
+		d.add(path, SubschemaRemoved, old.Type, nil, SeverityBreaking)
+		return
+	}
+
+	if old.Type != new.Type {
+		d.add(path, TypeChanged, old.Type, new.Type, SeverityBreaking)
+	}
+	if old.Description != new.Description {
+		d.add(path, DescriptionChanged, old.Description, new.Description, SeverityInfo)
+	}
+	if !reflect.DeepEqual(old.Default, new.Default) {
+		d.add(path, DefaultChanged, jsonValue(old.Default), jsonValue(new.Default), SeverityWarning)
+	}
+	if old.Nullable != new.Nullable {
+		d.addConstraint(path, "nullable", ConstraintChanged, old.Nullable, new.Nullable, severityIf(old.Nullable))
+	}
+	if old.Format != new.Format {
+		d.addConstraint(path, "format", ConstraintChanged, old.Format, new.Format, SeverityWarning)
+	}
+	if old.Pattern != new.Pattern {
+		d.addConstraint(path, "pattern", ConstraintChanged, old.Pattern, new.Pattern, severityIf(new.Pattern != ""))
+	}
+	if old.UniqueItems != new.UniqueItems {
+		d.addConstraint(path, "uniqueItems", ConstraintChanged, old.UniqueItems, new.UniqueItems, severityIf(new.UniqueItems))
+	}
+	d.upperFloat(path, "maximum", old.Maximum, new.Maximum)
+	d.lowerFloat(path, "minimum", old.Minimum, new.Minimum)
+	if old.ExclusiveMaximum != new.ExclusiveMaximum {
+		d.addConstraint(path, "exclusiveMaximum", ConstraintChanged, old.ExclusiveMaximum, new.ExclusiveMaximum, severityIf(new.ExclusiveMaximum))
+	}
+	if old.ExclusiveMinimum != new.ExclusiveMinimum {
+		d.addConstraint(path, "exclusiveMinimum", ConstraintChanged, old.ExclusiveMinimum, new.ExclusiveMinimum, severityIf(new.ExclusiveMinimum))
+	}
+	if !reflect.DeepEqual(old.MultipleOf, new.MultipleOf) {
+		d.addConstraint(path, "multipleOf", ConstraintChanged, floatValue(old.MultipleOf), floatValue(new.MultipleOf), severityIf(new.MultipleOf != nil))
+	}
+	d.upperInt(path, "maxLength", old.MaxLength, new.MaxLength)
+	d.lowerInt(path, "minLength", old.MinLength, new.MinLength)
+	d.upperInt(path, "maxItems", old.MaxItems, new.MaxItems)
+	d.lowerInt(path, "minItems", old.MinItems, new.MinItems)
+	d.upperInt(path, "maxProperties", old.MaxProperties, new.MaxProperties)
+	d.lowerInt(path, "minProperties", old.MinProperties, new.MinProperties)
+
+	d.enum(path, old.Enum, new.Enum)
+	d.required(path, old.Required, new.Required)
+	d.extensions(path, old, new)
+	d.properties(path, old.Properties, new.Properties)
+	d.items(path, old.Items, new.Items)
+	d.additionalProperties(path, old.AdditionalProperties, new.AdditionalProperties)
+	d.subschemas(pathTo(path, "allOf"), old.AllOf, new.AllOf)
+	d.subschemas(pathTo(path, "oneOf"), old.OneOf, new.OneOf)
+	d.subschemas(pathTo(path, "anyOf"), old.AnyOf, new.AnyOf)
+	d.schema(pathTo(path, "not"), old.Not, new.Not)
+}
+
+func (d *differ) properties(path string, old, new map[string]apiextensions.JSONSchemaProps) {
+	for _, name := range unionKeys(old, new) {
+		o, inOld := old[name]
+		n, inNew := new[name]
+		p := pathTo(path, name)
+		switch {
+		case !inOld:
+			d.add(p, FieldAdded, nil, n.Type, SeverityInfo)
+		case !inNew:
+			d.add(p, FieldRemoved, o.Type, nil, SeverityBreaking)
+		default:
+			d.schema(p, &o, &n)
+		}
+	}
+}
+
+func (d *differ) items(path string, old, new *apiextensions.JSONSchemaPropsOrArray) {
+	if old == nil {
+		old = &apiextensions.JSONSchemaPropsOrArray{}
+	}
+	if new == nil {
+		new = &apiextensions.JSONSchemaPropsOrArray{}
+	}
+	d.schema(path+"[]", old.Schema, new.Schema)
+	d.subschemas(path+"[]", old.JSONSchemas, new.JSONSchemas)
+}
+
+func (d *differ) additionalProperties(path string, old, new *apiextensions.JSONSchemaPropsOrBool) {
+	allows := func(s *apiextensions.JSONSchemaPropsOrBool) bool {
+		return s != nil && (s.Allows || s.Schema != nil)
+	}
+	if allows(old) != allows(new) {
+		d.add(pathTo(path, "*"), AdditionalPropertiesChanged, allows(old), allows(new), severityIf(allows(old)))
+		return
+	}
+	var o, n *apiextensions.JSONSchemaProps
+	if old != nil {
+		o = old.Schema
+	}
+	if new != nil {
+		n = new.Schema
+	}
+	d.schema(pathTo(path, "*"), o, n)
+}
+
+func (d *differ) subschemas(path string, old, new []apiextensions.JSONSchemaProps) {
+	for i := 0; i < len(old) || i < len(new); i++ {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case i >= len(old):
+			d.add(p, SubschemaAdded, nil, new[i].Type, SeverityWarning)
+		case i >= len(new):
+			d.add(p, SubschemaRemoved, old[i].Type, nil, SeverityWarning)
+		default:
+			d.schema(p, &old[i], &new[i])
+		}
+	}
+}
+
+func (d *differ) required(path string, old, new []string) {
+	o, n := stringSet(old), stringSet(new)
+	for _, r := range sortedKeys(n) {
+		if !o[r] {
+			d.add(pathTo(path, r), RequiredAdded, false, true, SeverityBreaking)
+		}
+	}
+	for _, r := range sortedKeys(o) {
+		if !n[r] {
+			d.add(pathTo(path, r), RequiredRemoved, true, false, SeverityInfo)
+		}
+	}
+}
+
+func (d *differ) enum(path string, old, new []apiextensions.JSON) {
+	if len(old) == 0 && len(new) == 0 {
+		return
+	}
+	if len(old) == 0 {
+		d.addConstraint(path, "enum", ConstraintChanged, nil, jsonValues(new), SeverityBreaking)
+		return
+	}
+	if len(new) == 0 {
+		d.addConstraint(path, "enum", ConstraintChanged, jsonValues(old), nil, SeverityInfo)
+		return
+	}
+	o, n := stringSet(jsonValues(old)), stringSet(jsonValues(new))
+	for _, v := range sortedKeys(n) {
+		if !o[v] {
+			d.add(path, EnumValueAdded, nil, v, SeverityInfo)
+		}
+	}
+	for _, v := range sortedKeys(o) {
+		if !n[v] {
+			d.add(path, EnumValueRemoved, v, nil, SeverityBreaking)
+		}
+	}
+}
+
+func (d *differ) extensions(path string, old, new *apiextensions.JSONSchemaProps) {
+	oldPreserve := old.XPreserveUnknownFields != nil && *old.XPreserveUnknownFields
+	newPreserve := new.XPreserveUnknownFields != nil && *new.XPreserveUnknownFields
+	if oldPreserve != newPreserve {
+		d.addConstraint(path, "x-kubernetes-preserve-unknown-fields", ExtensionChanged, oldPreserve, newPreserve, severityIf(oldPreserve))
+	}
+	if old.XEmbeddedResource != new.XEmbeddedResource {
+		d.addConstraint(path, "x-kubernetes-embedded-resource", ExtensionChanged, old.XEmbeddedResource, new.XEmbeddedResource, SeverityBreaking)
+	}
+	if old.XIntOrString != new.XIntOrString {
+		d.addConstraint(path, "x-kubernetes-int-or-string", ExtensionChanged, old.XIntOrString, new.XIntOrString, severityIf(old.XIntOrString))
+	}
+	if stringValue(old.XListType) != stringValue(new.XListType) {
+		d.addConstraint(path, "x-kubernetes-list-type", ExtensionChanged, stringValue(old.XListType), stringValue(new.XListType), SeverityWarning)
+	}
+	if !reflect.DeepEqual(old.XListMapKeys, new.XListMapKeys) {
+		d.addConstraint(path, "x-kubernetes-list-map-keys", ExtensionChanged, old.XListMapKeys, new.XListMapKeys, SeverityWarning)
+	}
+	if stringValue(old.XMapType) != stringValue(new.XMapType) {
+		d.addConstraint(path, "x-kubernetes-map-type", ExtensionChanged, stringValue(old.XMapType), stringValue(new.XMapType), SeverityWarning)
+	}
+}
+
+// upperFloat records a change to an upper bound, which is breaking if it was
+// introduced or lowered.
+func (d *differ) upperFloat(path, constraint string, old, new *float64) {
+	if reflect.DeepEqual(old, new) {
+		return
+	}
+	d.addConstraint(path, constraint, ConstraintChanged, floatValue(old), floatValue(new), severityIf(new != nil && (old == nil || *new < *old)))
+}
+
+// lowerFloat records a change to a lower bound, which is breaking if it was
+// introduced or raised.
+func (d *differ) lowerFloat(path, constraint string, old, new *float64) {
+	if reflect.DeepEqual(old, new) {
+		return
+	}
+	d.addConstraint(path, constraint, ConstraintChanged, floatValue(old), floatValue(new), severityIf(new != nil && (old == nil || *new > *old)))
+}
+
+func (d *differ) upperInt(path, constraint string, old, new *int64) {
+	if reflect.DeepEqual(old, new) {
+		return
+	}
+	d.addConstraint(path, constraint, ConstraintChanged, intValue(old), intValue(new), severityIf(new != nil && (old == nil || *new < *old)))
+}
+
+func (d *differ) lowerInt(path, constraint string, old, new *int64) {
+	if reflect.DeepEqual(old, new) {
+		return
+	}
+	d.addConstraint(path, constraint, ConstraintChanged, intValue(old), intValue(new), severityIf(new != nil && (old == nil || *new > *old)))
+}
+
+// severityIf returns SeverityBreaking if breaking is true, and SeverityInfo
+// otherwise.
+func severityIf(breaking bool) Severity {
+	if breaking {
+		return SeverityBreaking
+	}
+	return SeverityInfo
+}
+
+func pathTo(path, child string) string {
+	if path == "" {
+		return child
+	}
+	return path + "." + child
+}
+
+func unionKeys(a, b map[string]apiextensions.JSONSchemaProps) []string {
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return sortedKeys(keys)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func stringSet(s []string) map[string]bool {
+	set := make(map[string]bool, len(s))
+	for _, v := range s {
+		set[v] = true
+	}
+	return set
+}
+
+func jsonValue(j *apiextensions.JSON) interface{} {
+	if j == nil {
+		return nil
+	}
+	return *j
+}
+
+func jsonValues(js []apiextensions.JSON) []string {
+	values := make([]string, 0, len(js))
+	for _, j := range js {
+		b, err := json.Marshal(j)
+		if err != nil {
+			b = []byte(fmt.Sprint(j))
+		}
+		values = append(values, string(b))
+	}
+	return values
+}
+
+func floatValue(f *float64) interface{} {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
+
+func intValue(i *int64) interface{} {
+	if i == nil {
+		return nil
+	}
+	return *i
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"testing"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func mustSchema(t *testing.T, s string) *apiextensions.JSONSchemaProps {
+	t.Helper()
+	v1Schema := &v1.JSONSchemaProps{}
+	if err := yaml.Unmarshal([]byte(s), v1Schema); err != nil {
+		t.Fatalf("Failed to unmarshal schema: %s", err)
+	}
+	schema := &apiextensions.JSONSchemaProps{}
+	if err := v1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(v1Schema, schema, nil); err != nil {
+		t.Fatalf("Failed to convert schema: %s", err)
+	}
+	return schema
+}
+
+func TestDiff(t *testing.T) {
+	type change struct {
+		path       string
+		constraint string
+		t          ChangeType
+		severity   Severity
+	}
+	cases := []struct {
+		name     string
+		old      string
+		new      string
+		expected []change
+		breaking bool
+	}{
+		{
+			name: "identical",
+			old: `
+type: object
+properties:
+  host:
+    type: string
+`,
+			new: `
+type: object
+properties:
+  host:
+    type: string
+`,
+		},
+		{
+			name: "field added and removed",
+			old: `
+type: object
+properties:
+  host:
+    type: string
+`,
+			new: `
+type: object
+properties:
+  port:
+    type: integer
+`,
+			expected: []change{
+				{path: "host", t: FieldRemoved, severity: SeverityBreaking},
+				{path: "port", t: FieldAdded, severity: SeverityInfo},
+			},
+			breaking: true,
+		},
+		{
+			name: "nested items and additionalProperties",
+			old: `
+type: object
+properties:
+  containers:
+    type: array
+    items:
+      type: object
+      properties:
+        name:
+          type: string
+  labels:
+    type: object
+    additionalProperties:
+      type: string
+`,
+			new: `
+type: object
+properties:
+  containers:
+    type: array
+    items:
+      type: object
+      required:
+      - name
+      properties:
+        name:
+          type: string
+          maxLength: 63
+  labels:
+    type: object
+    additionalProperties:
+      type: integer
+`,
+			expected: []change{
+				{path: "containers[].name", t: RequiredAdded, severity: SeverityBreaking},
+				{path: "containers[].name", constraint: "maxLength", t: ConstraintChanged, severity: SeverityBreaking},
+				{path: "labels.*", t: TypeChanged, severity: SeverityBreaking},
+			},
+			breaking: true,
+		},
+		{
+			name: "enum and extensions",
+			old: `
+type: object
+properties:
+  tier:
+    type: string
+    enum:
+    - BASIC
+  port:
+    x-kubernetes-int-or-string: true
+  config:
+    type: object
+    x-kubernetes-preserve-unknown-fields: true
+`,
+			new: `
+type: object
+properties:
+  tier:
+    type: string
+    enum:
+    - BASIC
+    - STANDARD
+  port:
+    type: integer
+  config:
+    type: object
+`,
+			expected: []change{
+				{path: "config", constraint: "x-kubernetes-preserve-unknown-fields", t: ExtensionChanged, severity: SeverityBreaking},
+				{path: "port", t: TypeChanged, severity: SeverityBreaking},
+				{path: "port", constraint: "x-kubernetes-int-or-string", t: ExtensionChanged, severity: SeverityBreaking},
+				{path: "tier", t: EnumValueAdded, severity: SeverityInfo},
+			},
+			breaking: true,
+		},
+		{
+			name: "loosened constraints",
+			old: `
+type: object
+required:
+- host
+properties:
+  host:
+    type: string
+    oneOf:
+    - pattern: ^a
+  replicas:
+    type: integer
+    maximum: 3
+`,
+			new: `
+type: object
+properties:
+  host:
+    type: string
+    description: The host.
+    oneOf:
+    - pattern: ^a
+    - pattern: ^b
+  replicas:
+    type: integer
+    maximum: 5
+`,
+			expected: []change{
+				{path: "host", t: RequiredRemoved, severity: SeverityInfo},
+				{path: "host", t: DescriptionChanged, severity: SeverityInfo},
+				{path: "host.oneOf[1]", t: SubschemaAdded, severity: SeverityWarning},
+				{path: "replicas", constraint: "maximum", t: ConstraintChanged, severity: SeverityInfo},
+			},
+		},
+		{
+			name: "fields named like constraints",
+			old: `
+type: object
+properties:
+  maximum:
+    type: integer
+    maximum: 5
+`,
+			new: `
+type: object
+properties:
+  maximum:
+    type: integer
+    maximum: 3
+  pattern:
+    type: string
+    pattern: ^a
+`,
+			expected: []change{
+				{path: "maximum", constraint: "maximum", t: ConstraintChanged, severity: SeverityBreaking},
+				{path: "pattern", t: FieldAdded, severity: SeverityInfo},
+			},
+			breaking: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			changes := Diff(mustSchema(t, tc.old), mustSchema(t, tc.new))
+			if len(changes) != len(tc.expected) {
+				t.Fatalf("Expected %d changes, got %d: %v", len(tc.expected), len(changes), changes)
+			}
+			for i, c := range changes {
+				e := tc.expected[i]
+				if c.Path != e.path || c.Constraint != e.constraint || c.Type != e.t || c.Severity != e.severity {
+					t.Errorf("Expected change %v, got %v", e, c)
+				}
+			}
+			if IsBreaking(changes) != tc.breaking {
+				t.Errorf("Expected breaking to be %t", tc.breaking)
+			}
+		})
+	}
+}
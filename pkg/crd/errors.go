@@ -0,0 +1,203 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	openapierrors "github.com/go-openapi/errors"
+	"github.com/go-openapi/validate"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// FieldError is a single problem found when validating a CRD or an instance
+// of one. Rule is the schema keyword that failed, such as "maximum" or
+// "required", and is empty if the problem was not caused by a schema rule.
+type FieldError struct {
+	Field    string          `json:"field"`
+	Type     field.ErrorType `json:"type"`
+	BadValue interface{}     `json:"badValue,omitempty"`
+	Detail   string          `json:"detail,omitempty"`
+	Rule     string          `json:"rule,omitempty"`
+}
+
+func (e *FieldError) Error() string {
+	return e.fieldError().Error()
+}
+
+func (e *FieldError) fieldError() *field.Error {
+	return &field.Error{Type: e.Type, Field: e.Field, BadValue: e.BadValue, Detail: e.Detail}
+}
+
+// ValidationError is returned when a CRD or an instance of one is invalid. It
+// holds every problem that was found.
+type ValidationError struct {
+	Errors []*FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	errs := make(field.ErrorList, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		errs = append(errs, fe.fieldError())
+	}
+	return errs.ToAggregate().Error()
+}
+
+// ConversionError is returned by NewCRDer when a manifest could not be
+// converted from any supported version of the CRD API. Unwrap returns the
+// error for the version that the manifest declares.
+type ConversionError struct {
+	APIVersion string
+	V1Beta1    error
+	V1         error
+}
+
+func (e *ConversionError) Error() string {
+	return fmt.Sprintf("conversion unsuccessful: %s, %s", e.V1Beta1, e.V1)
+}
+
+func (e *ConversionError) Unwrap() error {
+	if e.APIVersion == v1beta1.SchemeGroupVersion.String() {
+		return e.V1Beta1
+	}
+	return e.V1
+}
+
+// schemaRules maps go-openapi validation failure codes to the schema keyword
+// that failed.
+var schemaRules = map[int32]string{
+	openapierrors.InvalidTypeCode:           "type",
+	openapierrors.RequiredFailCode:          "required",
+	openapierrors.TooLongFailCode:           "maxLength",
+	openapierrors.TooShortFailCode:          "minLength",
+	openapierrors.PatternFailCode:           "pattern",
+	openapierrors.EnumFailCode:              "enum",
+	openapierrors.MultipleOfFailCode:        "multipleOf",
+	openapierrors.MaxFailCode:               "maximum",
+	openapierrors.MinFailCode:               "minimum",
+	openapierrors.UniqueFailCode:            "uniqueItems",
+	openapierrors.MaxItemsFailCode:          "maxItems",
+	openapierrors.MinItemsFailCode:          "minItems",
+	openapierrors.NoAdditionalItemsCode:     "additionalItems",
+	openapierrors.TooFewPropertiesCode:      "minProperties",
+	openapierrors.TooManyPropertiesCode:     "maxProperties",
+	openapierrors.UnallowedPropertyCode:     "additionalProperties",
+	openapierrors.FailedAllPatternPropsCode: "patternProperties",
+}
+
+// newValidationError converts the result of validating instance to a
+// ValidationError, or returns nil if the instance is valid. It mirrors the
+// conversion made by the apiserver, but keeps the rule that failed and
+// reports the value of the instance rather than the limit of the rule.
+func newValidationError(res *validate.Result, instance interface{}) error {
+	if res.IsValid() {
+		return nil
+	}
+	verr := &ValidationError{}
+	for _, err := range res.Errors {
+		oerr, ok := err.(*openapierrors.Validation)
+		if !ok {
+			verr.Errors = append(verr.Errors, &FieldError{Type: field.ErrorTypeInvalid, BadValue: "", Detail: err.Error()})
+			continue
+		}
+		fe := &FieldError{Rule: schemaRules[oerr.Code()]}
+		if len(oerr.Name) > 0 && oerr.Name != "." {
+			fe.Field = strings.TrimPrefix(oerr.Name, ".")
+		}
+		switch oerr.Code() {
+		case openapierrors.RequiredFailCode:
+			fe.Type = field.ErrorTypeRequired
+		case openapierrors.EnumFailCode:
+			fe.Type = field.ErrorTypeNotSupported
+			fe.BadValue = oerr.Value
+			fe.Detail = notSupportedDetail(oerr.Values)
+		default:
+			fe.Type = field.ErrorTypeInvalid
+			fe.BadValue = ""
+			if v, ok := lookup(instance, fe.Field); ok {
+				fe.BadValue = v
+			} else if oerr.Value != nil {
+				fe.BadValue = oerr.Value
+			}
+			fe.Detail = oerr.Error()
+		}
+		verr.Errors = append(verr.Errors, fe)
+	}
+	return verr
+}
+
+// lookup returns the value at the dotted path of an unstructured object, as
+// reported by go-openapi, where list indexes are path elements.
+func lookup(obj interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return obj, true
+	}
+	for _, p := range strings.Split(path, ".") {
+		switch o := obj.(type) {
+		case map[string]interface{}:
+			v, ok := o[p]
+			if !ok {
+				return nil, false
+			}
+			obj = v
+		case []interface{}:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(o) {
+				return nil, false
+			}
+			obj = o[i]
+		default:
+			return nil, false
+		}
+	}
+	return obj, true
+}
+
+// newFieldListError converts errs to a ValidationError, or returns nil if
+// errs is empty.
+func newFieldListError(errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	verr := &ValidationError{}
+	for _, err := range errs {
+		verr.Errors = append(verr.Errors, &FieldError{
+			Field:    err.Field,
+			Type:     err.Type,
+			BadValue: err.BadValue,
+			Detail:   err.Detail,
+		})
+	}
+	return verr
+}
+
+func notSupportedDetail(allowed []interface{}) string {
+	values := []string{}
+	for _, v := range allowed {
+		if s, ok := v.(string); ok {
+			values = append(values, s)
+			continue
+		}
+		b, _ := json.Marshal(v)
+		values = append(values, string(b))
+	}
+	return field.NotSupported(nil, nil, values).Detail
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var rulescrd = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            required:
+            - schedule
+            properties:
+              schedule:
+                type: string
+              replicas:
+                type: integer
+                maximum: 10
+              policy:
+                type: string
+                enum:
+                - Allow
+                - Forbid
+  scope: Namespaced
+  names:
+    plural: crontabs
+    singular: crontab
+    kind: CronTab
+`)
+
+var broken = []byte(`
+apiVersion: example.com/v1
+kind: CronTab
+metadata:
+  name: my-new-cron-object
+spec:
+  replicas: 11
+  policy: Replace
+`)
+
+var invalidcrd = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+  scope: Sideways
+  names:
+    plural: crontabs
+    singular: crontab
+    kind: CronTab
+`)
+
+func TestValidationError(t *testing.T) {
+	c, err := NewCRDer(rulescrd)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	err = c.Validate(broken)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected *ValidationError, got %v", err)
+	}
+	got := map[string]FieldError{}
+	for _, fe := range verr.Errors {
+		got[fe.Field] = *fe
+	}
+	expected := map[string]struct {
+		errType  field.ErrorType
+		badValue interface{}
+		rule     string
+	}{
+		"spec.schedule": {errType: field.ErrorTypeRequired, rule: "required"},
+		"spec.replicas": {errType: field.ErrorTypeInvalid, badValue: float64(11), rule: "maximum"},
+		"spec.policy":   {errType: field.ErrorTypeNotSupported, badValue: "Replace", rule: "enum"},
+	}
+	if len(got) != len(expected) {
+		t.Errorf("Expected %d field errors, got %v", len(expected), verr.Errors)
+	}
+	for path, e := range expected {
+		fe, ok := got[path]
+		if !ok {
+			t.Errorf("Expected error for %s", path)
+			continue
+		}
+		if fe.Type != e.errType || fe.Rule != e.rule || !reflect.DeepEqual(fe.BadValue, e.badValue) {
+			t.Errorf("Expected %s error with rule %q and value %v for %s, got %+v", e.errType, e.rule, e.badValue, path, fe)
+		}
+	}
+}
+
+func TestConversionError(t *testing.T) {
+	_, err := NewCRDer(invalidcrd)
+	var cerr *ConversionError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("Expected *ConversionError, got %v", err)
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected *ValidationError for v1, got %v", cerr.V1)
+	}
+	if len(verr.Errors) == 0 || verr.Errors[0].Field != "spec.scope" {
+		t.Errorf("Expected field errors for v1, got %v", verr.Errors)
+	}
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+const (
+	invalidPathErr   = "invalid field path"
+	fieldNotFoundErr = "field not found"
+	notAnArrayErr    = "field is not an array"
+
+	// explainWidth is the width that descriptions are wrapped to, as by
+	// kubectl explain.
+	explainWidth = 80
+)
+
+// A FieldSchema is the schema of a field found by Lookup. Path is the path of
+// the field in the form used by Diff. Required is true if the field and each
+// of the fields that hold it are required, so that the field is set in every
+// object. Items of arrays and values of maps are required if their array or
+// map is.
+type FieldSchema struct {
+	Path     string
+	Schema   *apiextensions.JSONSchemaProps
+	Required bool
+}
+
+// Lookup returns the schema of the field at path in s. Path is a dotted list
+// of property names, such as spec.template.spec.containers[].resources. Array
+// items are selected with [] or an index, such as [0], or implicitly by
+// naming one of their properties. Map values are selected with * or any key
+// that is not a property. An empty path selects s itself.
+func Lookup(s *apiextensions.JSONSchemaProps, path string) (*FieldSchema, error) {
+	if s == nil {
+		return nil, errors.New(noSchemaErr)
+	}
+	segments, err := splitFieldPath(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &FieldSchema{Schema: s, Required: true}
+	for _, seg := range segments {
+		s := f.Schema
+		if strings.HasPrefix(seg, "[") {
+			if s.Items == nil || s.Items.Schema == nil {
+				return nil, fmt.Errorf("%s: %s", notAnArrayErr, f.Path)
+			}
+			f = &FieldSchema{Path: f.Path + "[]", Schema: s.Items.Schema, Required: f.Required}
+			continue
+		}
+		if s.Items != nil && s.Items.Schema != nil {
+			s = s.Items.Schema
+			f.Path += "[]"
+		}
+		if p, ok := s.Properties[seg]; ok {
+			f = &FieldSchema{Path: pathTo(f.Path, seg), Schema: &p, Required: f.Required && stringSet(s.Required)[seg]}
+			continue
+		}
+		if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+			f = &FieldSchema{Path: pathTo(f.Path, "*"), Schema: s.AdditionalProperties.Schema, Required: f.Required}
+			continue
+		}
+		return nil, fmt.Errorf("%s: %s", fieldNotFoundErr, pathTo(f.Path, seg))
+	}
+	return f, nil
+}
+
+// splitFieldPath splits a field path into property names and array
+// selectors.
+func splitFieldPath(path string) ([]string, error) {
+	var segments []string
+	path = strings.TrimPrefix(path, ".")
+	for path != "" {
+		switch i := strings.IndexAny(path, ".["); {
+		case i < 0:
+			segments = append(segments, path)
+			path = ""
+		case path[i] == '[':
+			j := strings.IndexByte(path, ']')
+			if j < i {
+				return nil, fmt.Errorf("%s: unclosed [", invalidPathErr)
+			}
+			if i > 0 {
+				segments = append(segments, path[:i])
+			}
+			segments = append(segments, path[i:j+1])
+			path = path[j+1:]
+			if path != "" && path[0] != '.' && path[0] != '[' {
+				return nil, fmt.Errorf("%s: expected . after ]", invalidPathErr)
+			}
+			path = strings.TrimPrefix(path, ".")
+		default:
+			if i == 0 {
+				return nil, fmt.Errorf("%s: empty field name", invalidPathErr)
+			}
+			segments = append(segments, path[:i])
+			path = path[i+1:]
+			if path == "" {
+				return nil, fmt.Errorf("%s: empty field name", invalidPathErr)
+			}
+		}
+	}
+	return segments, nil
+}
+
+// Explain describes the field at path in the schema of a version of the CRD
+// in the plain text format of kubectl explain.
+func (c *CRDer) Explain(version, path string) (string, error) {
+	if !hasVersion(c.CRD.Spec, version) {
+		return "", fmt.Errorf("%s: %s", unknownVersionErr, version)
+	}
+	sv := getVersionSchema(c.CRD.Spec, version)
+	if sv == nil || sv.OpenAPIV3Schema == nil {
+		return "", errors.New(noSchemaErr)
+	}
+	f, err := Lookup(sv.OpenAPIV3Schema, path)
+	if err != nil {
+		return "", err
+	}
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "KIND:     %s\n", c.CRD.Spec.Names.Kind)
+	fmt.Fprintf(b, "VERSION:  %s/%s\n\n", c.CRD.Spec.Group, version)
+	if f.Path != "" {
+		name := f.Path[strings.LastIndex(f.Path, ".")+1:]
+		label := "FIELD:   "
+		if explainProperties(f.Schema) != nil {
+			label = "RESOURCE:"
+		}
+		fmt.Fprintf(b, "%s %s <%s>\n\n", label, name, explainType(f.Schema))
+	}
+	b.WriteString("DESCRIPTION:\n")
+	if d := strings.TrimSpace(f.Schema.Description); d != "" {
+		writeWrapped(b, d, "     ")
+	} else {
+		b.WriteString("     <empty>\n")
+	}
+	if props := explainProperties(f.Schema); props != nil {
+		b.WriteString("\nFIELDS:\n")
+		required := stringSet(props.Required)
+		for i, name := range unionKeys(props.Properties, nil) {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			p := props.Properties[name]
+			fmt.Fprintf(b, "   %s\t<%s>", name, explainType(&p))
+			if required[name] {
+				b.WriteString(" -required-")
+			}
+			b.WriteString("\n")
+			if d := strings.TrimSpace(p.Description); d != "" {
+				writeWrapped(b, d, "     ")
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// explainProperties returns the schema whose properties are listed for a
+// field: its own, or that of its items or map values. It is nil if the field
+// has no properties.
+func explainProperties(s *apiextensions.JSONSchemaProps) *apiextensions.JSONSchemaProps {
+	for s != nil {
+		if len(s.Properties) > 0 {
+			return s
+		}
+		switch {
+		case s.Items != nil && s.Items.Schema != nil:
+			s = s.Items.Schema
+		case s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil:
+			s = s.AdditionalProperties.Schema
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// explainType returns the type of a field as shown by kubectl explain.
+func explainType(s *apiextensions.JSONSchemaProps) string {
+	switch {
+	case s.XIntOrString:
+		return "int-or-string"
+	case s.Type == "array" && s.Items != nil && s.Items.Schema != nil:
+		return "[]" + explainType(s.Items.Schema)
+	case s.Type == "object" && len(s.Properties) == 0 && s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil:
+		return "map[string]" + explainType(s.AdditionalProperties.Schema)
+	case s.Type == "object":
+		return "Object"
+	case s.Type == "":
+		return "any"
+	}
+	return s.Type
+}
+
+// writeWrapped writes text wrapped to explainWidth with each line indented.
+// Line breaks in text are kept.
+func writeWrapped(b *strings.Builder, text, indent string) {
+	for _, line := range strings.Split(text, "\n") {
+		n := len(indent)
+		b.WriteString(indent)
+		for i, word := range strings.Fields(line) {
+			if i > 0 && n+1+len(word) > explainWidth {
+				b.WriteString("\n" + indent)
+				n = len(indent)
+			} else if i > 0 {
+				b.WriteString(" ")
+				n++
+			}
+			b.WriteString(word)
+			n += len(word)
+		}
+		b.WriteString("\n")
+	}
+}
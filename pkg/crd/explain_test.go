@@ -0,0 +1,152 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"testing"
+)
+
+var explaincrd = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        description: CronTab runs a job on a schedule.
+        required:
+        - spec
+        properties:
+          spec:
+            type: object
+            required:
+            - containers
+            properties:
+              containers:
+                type: array
+                description: Containers to run.
+                items:
+                  type: object
+                  required:
+                  - name
+                  properties:
+                    name:
+                      type: string
+                      description: Name of the container.
+                    resources:
+                      type: object
+                      required:
+                      - limits
+                      properties:
+                        limits:
+                          type: object
+                          additionalProperties:
+                            x-kubernetes-int-or-string: true
+              labels:
+                type: object
+                additionalProperties:
+                  type: string
+  scope: Namespaced
+  names:
+    plural: crontabs
+    singular: crontab
+    kind: CronTab
+`)
+
+func TestLookup(t *testing.T) {
+	c, err := NewCRDer(explaincrd)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	s := getVersionSchema(c.CRD.Spec, "v1").OpenAPIV3Schema
+	cases := []struct {
+		path         string
+		expectedPath string
+		expectedType string
+		required     bool
+		expectedErr  bool
+	}{
+		{path: "", expectedPath: "", expectedType: "object", required: true},
+		{path: "spec.containers", expectedPath: "spec.containers", expectedType: "array", required: true},
+		{path: "spec.containers[]", expectedPath: "spec.containers[]", expectedType: "object", required: true},
+		{path: "spec.containers[0].name", expectedPath: "spec.containers[].name", expectedType: "string", required: true},
+		{path: ".spec.containers.name", expectedPath: "spec.containers[].name", expectedType: "string", required: true},
+		{path: "spec.containers[].resources", expectedPath: "spec.containers[].resources", expectedType: "object"},
+		{path: "spec.containers[].resources.limits", expectedPath: "spec.containers[].resources.limits", expectedType: "object"},
+		{path: "spec.containers[].resources.limits.cpu", expectedPath: "spec.containers[].resources.limits.*", expectedType: ""},
+		{path: "spec.labels.*", expectedPath: "spec.labels.*", expectedType: "string"},
+		{path: "spec.image", expectedErr: true},
+		{path: "spec.labels[]", expectedErr: true},
+		{path: "spec..containers", expectedErr: true},
+		{path: "spec.containers[0", expectedErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.path, func(t *testing.T) {
+			f, err := Lookup(s, tc.path)
+			if err != nil {
+				if !tc.expectedErr {
+					t.Errorf("Unexpected lookup error: %s", err)
+				}
+				return
+			}
+			if tc.expectedErr {
+				t.Fatalf("Expected lookup error, got %+v", f)
+			}
+			if f.Path != tc.expectedPath || f.Schema.Type != tc.expectedType || f.Required != tc.required {
+				t.Errorf("Expected %s %q (required %t), got %s %q (required %t)", tc.expectedPath, tc.expectedType, tc.required, f.Path, f.Schema.Type, f.Required)
+			}
+		})
+	}
+}
+
+func TestExplain(t *testing.T) {
+	c, err := NewCRDer(explaincrd)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	got, err := c.Explain("v1", "spec.containers")
+	if err != nil {
+		t.Fatalf("Failed to explain: %s", err)
+	}
+	expected := `KIND:     CronTab
+VERSION:  example.com/v1
+
+RESOURCE: containers <[]Object>
+
+DESCRIPTION:
+     Containers to run.
+
+FIELDS:
+   name	<string> -required-
+     Name of the container.
+
+   resources	<Object>
+`
+	if got != expected {
+		t.Errorf("Expected explanation:\n%s\ngot:\n%s", expected, got)
+	}
+	if _, err := c.Explain("v2", "spec"); err == nil {
+		t.Error("Expected error for unknown version")
+	}
+}
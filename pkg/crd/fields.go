@@ -0,0 +1,180 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+var (
+	// anchorReg and spaceReg match the characters removed and replaced by
+	// the slugify function used for anchors on the doc page.
+	anchorReg = regexp.MustCompile(`[^\w\s$*_+~.()'"!:@-]+`)
+	spaceReg  = regexp.MustCompile(`\s+`)
+)
+
+// A Field is a field of a CRD schema as it is shown in documentation. Fields
+// of array items are the fields of the array, as on the doc page. Path is the
+// dotted path of the field, as used by Diff, and Anchor is the fragment that
+// links to the field on the doc page.
+type Field struct {
+	Name        string
+	Path        string
+	Anchor      string
+	Type        string
+	Required    bool
+	Description string
+	Default     string
+	Constraints []string
+	Fields      []Field
+}
+
+// Fields returns the tree of fields of a schema, ordered by name. The
+// apiVersion, kind and metadata of the resource are left out, as on the doc
+// page.
+func Fields(s *apiextensions.JSONSchemaProps) []Field {
+	if s == nil {
+		return nil
+	}
+	return fields(s, "", "")
+}
+
+// isResourceField returns whether the root property name of s is one that
+// every resource has.
+func isResourceField(s *apiextensions.JSONSchemaProps, name string) bool {
+	switch name {
+	case "apiVersion", "kind":
+		return true
+	case "metadata":
+		return s.Properties[name].Type == "object"
+	}
+	return false
+}
+
+func fields(s *apiextensions.JSONSchemaProps, path, anchor string) []Field {
+	required := stringSet(s.Required)
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		if path == "" && isResourceField(s, name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fs := make([]Field, 0, len(names))
+	for _, name := range names {
+		prop := s.Properties[name]
+		f := Field{
+			Name:        name,
+			Path:        pathTo(path, name),
+			Anchor:      slugify(name),
+			Type:        prop.Type,
+			Required:    required[name],
+			Description: prop.Description,
+			Constraints: constraints(&prop),
+		}
+		if anchor != "" {
+			f.Anchor = anchor + "-" + f.Anchor
+		}
+		if prop.XIntOrString {
+			f.Type = "int-or-string"
+		}
+		if prop.Default != nil {
+			if b, err := json.Marshal(*prop.Default); err == nil {
+				f.Default = string(b)
+			}
+		}
+		children, childPath := &prop, f.Path
+		if prop.Type == "array" && prop.Items != nil && prop.Items.Schema != nil {
+			items := prop.Items.Schema
+			f.Type = "[]" + items.Type
+			children, childPath = items, f.Path+"[]"
+		}
+		f.Fields = fields(children, childPath, f.Anchor)
+		fs = append(fs, f)
+	}
+	return fs
+}
+
+// constraints returns a description of each validation rule of s.
+func constraints(s *apiextensions.JSONSchemaProps) []string {
+	var c []string
+	add := func(format string, args ...interface{}) {
+		c = append(c, fmt.Sprintf(format, args...))
+	}
+	if s.Format != "" {
+		add("format: %s", s.Format)
+	}
+	if s.Pattern != "" {
+		add("pattern: %s", s.Pattern)
+	}
+	if len(s.Enum) > 0 {
+		add("enum: %s", strings.Join(jsonValues(s.Enum), ", "))
+	}
+	if s.Minimum != nil {
+		if s.ExclusiveMinimum {
+			add("minimum: %v (exclusive)", *s.Minimum)
+		} else {
+			add("minimum: %v", *s.Minimum)
+		}
+	}
+	if s.Maximum != nil {
+		if s.ExclusiveMaximum {
+			add("maximum: %v (exclusive)", *s.Maximum)
+		} else {
+			add("maximum: %v", *s.Maximum)
+		}
+	}
+	if s.MultipleOf != nil {
+		add("multipleOf: %v", *s.MultipleOf)
+	}
+	if s.MinLength != nil {
+		add("minLength: %d", *s.MinLength)
+	}
+	if s.MaxLength != nil {
+		add("maxLength: %d", *s.MaxLength)
+	}
+	if s.MinItems != nil {
+		add("minItems: %d", *s.MinItems)
+	}
+	if s.MaxItems != nil {
+		add("maxItems: %d", *s.MaxItems)
+	}
+	if s.UniqueItems {
+		add("uniqueItems: true")
+	}
+	if s.MinProperties != nil {
+		add("minProperties: %d", *s.MinProperties)
+	}
+	if s.MaxProperties != nil {
+		add("maxProperties: %d", *s.MaxProperties)
+	}
+	if s.Nullable {
+		add("nullable: true")
+	}
+	return c
+}
+
+func slugify(s string) string {
+	return spaceReg.ReplaceAllString(strings.TrimSpace(anchorReg.ReplaceAllString(s, "")), "-")
+}
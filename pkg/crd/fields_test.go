@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"reflect"
+	"testing"
+)
+
+var fieldscrd = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          apiVersion:
+            type: string
+          kind:
+            type: string
+          metadata:
+            type: object
+          spec:
+            type: object
+            required:
+            - schedule
+            properties:
+              schedule:
+                type: string
+                description: Schedule in cron format.
+                pattern: '^\S+$'
+              replicas:
+                type: integer
+                default: 1
+                minimum: 0
+              policy:
+                type: string
+                enum:
+                - Allow
+                - Forbid
+              port:
+                x-kubernetes-int-or-string: true
+              containers:
+                type: array
+                maxItems: 5
+                items:
+                  type: object
+                  properties:
+                    name:
+                      type: string
+  scope: Namespaced
+  names:
+    plural: crontabs
+    singular: crontab
+    kind: CronTab
+`)
+
+func TestFields(t *testing.T) {
+	c, err := NewCRDer(fieldscrd)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	fs := Fields(getVersionSchema(c.CRD.Spec, "v1").OpenAPIV3Schema)
+	if len(fs) != 1 || fs[0].Name != "spec" {
+		t.Fatalf("Expected a single spec field, got %+v", fs)
+	}
+	expected := []Field{
+		{
+			Name:        "containers",
+			Path:        "spec.containers",
+			Anchor:      "spec-containers",
+			Type:        "[]object",
+			Constraints: []string{"maxItems: 5"},
+			Fields: []Field{
+				{Name: "name", Path: "spec.containers[].name", Anchor: "spec-containers-name", Type: "string", Fields: []Field{}},
+			},
+		},
+		{Name: "policy", Path: "spec.policy", Anchor: "spec-policy", Type: "string", Constraints: []string{`enum: "Allow", "Forbid"`}, Fields: []Field{}},
+		{Name: "port", Path: "spec.port", Anchor: "spec-port", Type: "int-or-string", Fields: []Field{}},
+		{Name: "replicas", Path: "spec.replicas", Anchor: "spec-replicas", Type: "integer", Default: "1", Constraints: []string{"minimum: 0"}, Fields: []Field{}},
+		{Name: "schedule", Path: "spec.schedule", Anchor: "spec-schedule", Type: "string", Required: true, Description: "Schedule in cron format.", Constraints: []string{`pattern: ^\S+$`}, Fields: []Field{}},
+	}
+	if !reflect.DeepEqual(fs[0].Fields, expected) {
+		t.Errorf("Expected fields:\n%+v\ngot:\n%+v", expected, fs[0].Fields)
+	}
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+const (
+	metav1Import          = `metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"`
+	apiextensionsv1Import = `apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"`
+	runtimeImport         = `"k8s.io/apimachinery/pkg/runtime"`
+	intstrImport          = `"k8s.io/apimachinery/pkg/util/intstr"`
+)
+
+// initialisms are words that are written in upper case in Go identifiers.
+var initialisms = map[string]bool{
+	"ACL": true, "API": true, "CA": true, "CIDR": true, "CPU": true, "CRD": true,
+	"DNS": true, "HTTP": true, "HTTPS": true, "ID": true, "IP": true, "JSON": true,
+	"SSH": true, "TCP": true, "TLS": true, "TTL": true, "UDP": true, "UID": true,
+	"URI": true, "URL": true, "UUID": true, "YAML": true,
+}
+
+// GoTypes returns Go source for package pkg that declares types for the
+// version of the CRD held by the CRDer. Fields that are not required are
+// pointers, where they are not already nillable, and are omitted when empty.
+// Types are named after the path to them and carry the markers used by
+// controller-gen to generate deepcopy functions.
+func (c *CRDer) GoTypes(pkg string) ([]byte, error) {
+	sv := getVersionSchema(c.CRD.Spec, c.GVK.Version)
+	if sv == nil || sv.OpenAPIV3Schema == nil {
+		return nil, errors.New(noSchemaErr)
+	}
+	g := &goGenerator{
+		imports: map[string]bool{metav1Import: true},
+		names:   map[string]bool{c.GVK.Kind: true, c.GVK.Kind + "List": true},
+	}
+	root := g.fields(c.GVK.Kind, sv.OpenAPIV3Schema, true)
+
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "// Package %s contains API types for %s/%s.\n", pkg, c.GVK.Group, c.GVK.Version)
+	fmt.Fprintf(b, "// +kubebuilder:object:generate=true\n// +groupName=%s\npackage %s\n\n", c.GVK.Group, pkg)
+	b.WriteString("import (\n")
+	for _, i := range sortedKeys(g.imports) {
+		b.WriteString(i + "\n")
+	}
+	b.WriteString(")\n\n")
+
+	writeComment(b, sv.OpenAPIV3Schema.Description)
+	b.WriteString("// +kubebuilder:object:root=true\n")
+	if c.CRD.Spec.Scope == apiextensions.ClusterScoped {
+		b.WriteString("// +kubebuilder:resource:scope=Cluster\n")
+	}
+	fmt.Fprintf(b, "type %s struct {\n", c.GVK.Kind)
+	b.WriteString("metav1.TypeMeta `json:\",inline\"`\n")
+	b.WriteString("metav1.ObjectMeta `json:\"metadata,omitempty\"`\n\n")
+	b.WriteString(root)
+	b.WriteString("}\n\n")
+
+	fmt.Fprintf(b, "// %sList is a list of %s.\n", c.GVK.Kind, c.GVK.Kind)
+	b.WriteString("// +kubebuilder:object:root=true\n")
+	fmt.Fprintf(b, "type %sList struct {\n", c.GVK.Kind)
+	b.WriteString("metav1.TypeMeta `json:\",inline\"`\n")
+	b.WriteString("metav1.ListMeta `json:\"metadata,omitempty\"`\n")
+	fmt.Fprintf(b, "Items []%s `json:\"items\"`\n}\n", c.GVK.Kind)
+
+	for _, t := range g.types {
+		b.WriteString("\n")
+		b.WriteString(t)
+	}
+	return format.Source(b.Bytes())
+}
+
+type goGenerator struct {
+	imports map[string]bool
+	names   map[string]bool
+	types   []string
+}
+
+// fields returns the struct fields for the properties of s. The object
+// metadata fields are skipped at the root of a schema.
+func (g *goGenerator) fields(typeName string, s *apiextensions.JSONSchemaProps, root bool) string {
+	required := stringSet(s.Required)
+	names := map[string]bool{}
+	b := &bytes.Buffer{}
+	keys := make([]string, 0, len(s.Properties))
+	for k := range s.Properties {
+		if root && metaFields[k] {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		prop := s.Properties[k]
+		name := uniqueName(goName(k), names)
+		typ := g.goType(typeName+name, &prop)
+		tag := k
+		if !required[k] {
+			tag += ",omitempty"
+			if !nillable(typ) {
+				typ = "*" + typ
+			}
+		}
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		writeComment(b, prop.Description)
+		if !required[k] {
+			b.WriteString("// +optional\n")
+		}
+		fmt.Fprintf(b, "%s %s `json:\"%s\"`\n", name, typ, tag)
+	}
+	return b.String()
+}
+
+// goType returns the Go type for s, declaring a struct type named after name
+// if s is an object with properties.
+func (g *goGenerator) goType(name string, s *apiextensions.JSONSchemaProps) string {
+	switch {
+	case s.XIntOrString:
+		g.imports[intstrImport] = true
+		return "intstr.IntOrString"
+	case s.XEmbeddedResource:
+		g.imports[runtimeImport] = true
+		return "runtime.RawExtension"
+	}
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			return "metav1.Time"
+		}
+		return "string"
+	case "integer":
+		if s.Format == "int32" {
+			return "int32"
+		}
+		return "int64"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		if s.Items == nil || s.Items.Schema == nil {
+			return "[]" + g.json()
+		}
+		return "[]" + g.goType(name, s.Items.Schema)
+	case "object":
+		if len(s.Properties) > 0 {
+			return g.declare(name, s)
+		}
+		if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+			return "map[string]" + g.goType(name+"Value", s.AdditionalProperties.Schema)
+		}
+		if s.XPreserveUnknownFields == nil || !*s.XPreserveUnknownFields {
+			return "map[string]" + g.json()
+		}
+	}
+	return g.json()
+}
+
+// declare declares a struct type for the object s and returns its name.
+func (g *goGenerator) declare(name string, s *apiextensions.JSONSchemaProps) string {
+	name = uniqueName(name, g.names)
+	b := &bytes.Buffer{}
+	writeComment(b, s.Description)
+	fmt.Fprintf(b, "type %s struct {\n", name)
+	// Declare the fields first so that nested types follow their parent.
+	idx := len(g.types)
+	g.types = append(g.types, "")
+	b.WriteString(g.fields(name, s, false))
+	b.WriteString("}\n")
+	g.types[idx] = b.String()
+	return name
+}
+
+func (g *goGenerator) json() string {
+	g.imports[apiextensionsv1Import] = true
+	return "apiextensionsv1.JSON"
+}
+
+func nillable(typ string) bool {
+	return strings.HasPrefix(typ, "[]") || strings.HasPrefix(typ, "map[")
+}
+
+// goName converts a JSON field name to an exported Go identifier.
+func goName(s string) string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = nil
+		}
+	}
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+			continue
+		case unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))):
+			flush()
+		}
+		word = append(word, r)
+	}
+	flush()
+
+	b := &strings.Builder{}
+	for _, w := range words {
+		if upper := strings.ToUpper(w); initialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		r := []rune(w)
+		b.WriteRune(unicode.ToUpper(r[0]))
+		b.WriteString(string(r[1:]))
+	}
+	name := b.String()
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		name = "X" + name
+	}
+	return name
+}
+
+// uniqueName returns name, with a numeric suffix if it is already in names,
+// and adds it to names.
+func uniqueName(name string, names map[string]bool) string {
+	n := name
+	for i := 2; names[n]; i++ {
+		n = fmt.Sprintf("%s%d", name, i)
+	}
+	names[n] = true
+	return n
+}
+
+func writeComment(b *bytes.Buffer, description string) {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		return
+	}
+	for _, line := range strings.Split(description, "\n") {
+		b.WriteString(strings.TrimRight("// "+line, " ") + "\n")
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+var gotypescrd = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        description: CronTab runs a job on a schedule.
+        type: object
+        properties:
+          spec:
+            type: object
+            required:
+            - schedule
+            properties:
+              schedule:
+                description: Schedule in cron format.
+                type: string
+              suspendUntil:
+                type: string
+                format: date-time
+              port:
+                x-kubernetes-int-or-string: true
+              containers:
+                type: array
+                items:
+                  type: object
+                  properties:
+                    imageURL:
+                      type: string
+              labels:
+                type: object
+                additionalProperties:
+                  type: string
+              config:
+                type: object
+                x-kubernetes-preserve-unknown-fields: true
+  scope: Namespaced
+  names:
+    plural: crontabs
+    singular: crontab
+    kind: CronTab
+`)
+
+func TestGoTypes(t *testing.T) {
+	c, err := NewCRDer(gotypescrd)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	src, err := c.GoTypes("v1")
+	if err != nil {
+		t.Fatalf("Failed to generate Go types: %s", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", src, parser.AllErrors); err != nil {
+		t.Fatalf("Generated Go types do not parse: %s\n%s", err, src)
+	}
+	// Compare without alignment whitespace.
+	got := strings.Join(strings.Fields(string(src)), " ")
+	for _, expected := range []string{
+		"// CronTab runs a job on a schedule. // +kubebuilder:object:root=true type CronTab struct {",
+		"Spec *CronTabSpec `json:\"spec,omitempty\"`",
+		"Items []CronTab `json:\"items\"`",
+		"// Schedule in cron format. Schedule string `json:\"schedule\"`",
+		"SuspendUntil *metav1.Time `json:\"suspendUntil,omitempty\"`",
+		"Port *intstr.IntOrString `json:\"port,omitempty\"`",
+		"Containers []CronTabSpecContainers `json:\"containers,omitempty\"`",
+		"ImageURL *string `json:\"imageURL,omitempty\"`",
+		"Labels map[string]string `json:\"labels,omitempty\"`",
+		"Config *apiextensionsv1.JSON `json:\"config,omitempty\"`",
+	} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("Expected generated Go types to contain %q, got:\n%s", expected, src)
+		}
+	}
+}
+
+func TestGoName(t *testing.T) {
+	cases := map[string]string{
+		"apiVersion":            "APIVersion",
+		"podIP":                 "PodIP",
+		"alternativeLocationId": "AlternativeLocationID",
+		"HTTPHeaders":           "HTTPHeaders",
+		"x-kubernetes-field":    "XKubernetesField",
+		"2fa":                   "X2fa",
+	}
+	for in, expected := range cases {
+		if got := goName(in); got != expected {
+			t.Errorf("goName(%q): expected %q, got %q", in, expected, got)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+const (
+	draft07 = "http://json-schema.org/draft-07/schema#"
+
+	unknownVersionErr = "crd has no such version"
+)
+
+// JSONSchema returns the schema of a version of the CRD as JSON Schema
+// draft-07. The schema requires apiVersion and kind to match the version. If
+// strict is true, objects do not allow properties that are not in the schema,
+// unless unknown fields are preserved or properties are declared in allOf,
+// anyOf or oneOf.
+func (c *CRDer) JSONSchema(version string, strict bool) (map[string]interface{}, error) {
+	if !hasVersion(c.CRD.Spec, version) {
+		return nil, fmt.Errorf("%s: %s", unknownVersionErr, version)
+	}
+	sv := getVersionSchema(c.CRD.Spec, version)
+	if sv == nil || sv.OpenAPIV3Schema == nil {
+		return nil, errors.New(noSchemaErr)
+	}
+
+	s := toJSONSchema(sv.OpenAPIV3Schema, strict)
+	s["$schema"] = draft07
+	props, _ := s["properties"].(map[string]interface{})
+	if props == nil {
+		props = map[string]interface{}{}
+		s["properties"] = props
+	}
+	props["apiVersion"] = map[string]interface{}{
+		"type": "string",
+		"enum": []interface{}{c.CRD.Spec.Group + "/" + version},
+	}
+	props["kind"] = map[string]interface{}{
+		"type": "string",
+		"enum": []interface{}{c.CRD.Spec.Names.Kind},
+	}
+	if _, ok := props["metadata"]; !ok {
+		props["metadata"] = map[string]interface{}{"type": "object"}
+	}
+	required := []interface{}{"apiVersion", "kind"}
+	if r, ok := s["required"].([]interface{}); ok {
+		for _, name := range r {
+			if name != "apiVersion" && name != "kind" {
+				required = append(required, name)
+			}
+		}
+	}
+	s["required"] = required
+	return s, nil
+}
+
+// toJSONSchema converts an OpenAPI v3 schema to JSON Schema draft-07.
+func toJSONSchema(s *apiextensions.JSONSchemaProps, strict bool) map[string]interface{} {
+	j := map[string]interface{}{}
+	set := func(k string, v interface{}, ok bool) {
+		if ok {
+			j[k] = v
+		}
+	}
+	set("title", s.Title, s.Title != "")
+	set("description", s.Description, s.Description != "")
+	set("format", s.Format, s.Format != "")
+	set("pattern", s.Pattern, s.Pattern != "")
+	set("default", jsonValue(s.Default), s.Default != nil)
+	set("examples", []interface{}{jsonValue(s.Example)}, s.Example != nil)
+	set("multipleOf", floatValue(s.MultipleOf), s.MultipleOf != nil)
+	set("maxLength", intValue(s.MaxLength), s.MaxLength != nil)
+	set("minLength", intValue(s.MinLength), s.MinLength != nil)
+	set("maxItems", intValue(s.MaxItems), s.MaxItems != nil)
+	set("minItems", intValue(s.MinItems), s.MinItems != nil)
+	set("uniqueItems", true, s.UniqueItems)
+	set("maxProperties", intValue(s.MaxProperties), s.MaxProperties != nil)
+	set("minProperties", intValue(s.MinProperties), s.MinProperties != nil)
+
+	// Draft-04 exclusive bounds are booleans that modify maximum and
+	// minimum, while draft-07 bounds are numbers.
+	if s.Maximum != nil {
+		if s.ExclusiveMaximum {
+			j["exclusiveMaximum"] = *s.Maximum
+		} else {
+			j["maximum"] = *s.Maximum
+		}
+	}
+	if s.Minimum != nil {
+		if s.ExclusiveMinimum {
+			j["exclusiveMinimum"] = *s.Minimum
+		} else {
+			j["minimum"] = *s.Minimum
+		}
+	}
+
+	var types []interface{}
+	switch {
+	case s.XIntOrString:
+		types = []interface{}{"integer", "string"}
+	case s.Type != "":
+		types = []interface{}{s.Type}
+	}
+	if s.Nullable && len(types) > 0 {
+		types = append(types, "null")
+	}
+	switch len(types) {
+	case 0:
+	case 1:
+		j["type"] = types[0]
+	default:
+		j["type"] = types
+	}
+
+	if len(s.Enum) > 0 {
+		enum := make([]interface{}, 0, len(s.Enum)+1)
+		for i := range s.Enum {
+			enum = append(enum, jsonValue(&s.Enum[i]))
+		}
+		if s.Nullable {
+			enum = append(enum, nil)
+		}
+		j["enum"] = enum
+	}
+	if len(s.Required) > 0 {
+		required := make([]interface{}, 0, len(s.Required))
+		for _, r := range s.Required {
+			required = append(required, r)
+		}
+		j["required"] = required
+	}
+
+	if len(s.Properties) > 0 {
+		j["properties"] = toJSONSchemaMap(s.Properties, strict)
+	}
+	if len(s.PatternProperties) > 0 {
+		j["patternProperties"] = toJSONSchemaMap(s.PatternProperties, strict)
+	}
+	preserve := s.XPreserveUnknownFields != nil && *s.XPreserveUnknownFields
+	switch {
+	case s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil:
+		j["additionalProperties"] = toJSONSchema(s.AdditionalProperties.Schema, strict)
+	case s.AdditionalProperties != nil:
+		j["additionalProperties"] = s.AdditionalProperties.Allows
+	case strict && !preserve && len(s.Properties) > 0 && !hasJunctorProperties(s):
+		j["additionalProperties"] = false
+	}
+	if s.Items != nil {
+		switch {
+		case s.Items.Schema != nil:
+			j["items"] = toJSONSchema(s.Items.Schema, strict)
+		case len(s.Items.JSONSchemas) > 0:
+			j["items"] = toJSONSchemaList(s.Items.JSONSchemas, strict)
+		}
+	}
+	if s.AdditionalItems != nil {
+		if s.AdditionalItems.Schema != nil {
+			j["additionalItems"] = toJSONSchema(s.AdditionalItems.Schema, strict)
+		} else {
+			j["additionalItems"] = s.AdditionalItems.Allows
+		}
+	}
+	// The properties declared in junctors apply to the same objects as those
+	// of the enclosing schema, so they are never strict.
+	set("allOf", toJSONSchemaList(s.AllOf, false), len(s.AllOf) > 0)
+	set("anyOf", toJSONSchemaList(s.AnyOf, false), len(s.AnyOf) > 0)
+	set("oneOf", toJSONSchemaList(s.OneOf, false), len(s.OneOf) > 0)
+	if s.Not != nil {
+		j["not"] = toJSONSchema(s.Not, false)
+	}
+	// An embedded resource is a Kubernetes object in its own right.
+	if s.XEmbeddedResource {
+		props, _ := j["properties"].(map[string]interface{})
+		if props == nil {
+			props = map[string]interface{}{}
+			j["properties"] = props
+		}
+		for _, k := range []string{"apiVersion", "kind"} {
+			if _, ok := props[k]; !ok {
+				props[k] = map[string]interface{}{"type": "string"}
+			}
+		}
+		if _, ok := props["metadata"]; !ok {
+			props["metadata"] = map[string]interface{}{"type": "object"}
+		}
+	}
+	return j
+}
+
+func toJSONSchemaMap(m map[string]apiextensions.JSONSchemaProps, strict bool) map[string]interface{} {
+	props := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		v := v
+		props[k] = toJSONSchema(&v, strict)
+	}
+	return props
+}
+
+// hasJunctorProperties returns true if properties are declared in the allOf,
+// anyOf or oneOf of s.
+func hasJunctorProperties(s *apiextensions.JSONSchemaProps) bool {
+	for _, js := range [][]apiextensions.JSONSchemaProps{s.AllOf, s.AnyOf, s.OneOf} {
+		for i := range js {
+			if len(js[i].Properties) > 0 || hasJunctorProperties(&js[i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func toJSONSchemaList(l []apiextensions.JSONSchemaProps, strict bool) []interface{} {
+	schemas := make([]interface{}, 0, len(l))
+	for i := range l {
+		schemas = append(schemas, toJSONSchema(&l[i], strict))
+	}
+	return schemas
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var jsonschemacrd = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            required:
+            - schedule
+            properties:
+              schedule:
+                type: string
+              port:
+                x-kubernetes-int-or-string: true
+              policy:
+                type: string
+                nullable: true
+                enum:
+                - Allow
+                - Forbid
+              replicas:
+                type: integer
+                maximum: 10
+                exclusiveMaximum: true
+              config:
+                type: object
+                x-kubernetes-preserve-unknown-fields: true
+                properties:
+                  name:
+                    type: string
+              target:
+                type: object
+                properties:
+                  kind:
+                    type: string
+                  name:
+                    type: string
+                  selector:
+                    type: object
+                    properties:
+                      app:
+                        type: string
+                allOf:
+                - properties:
+                    name:
+                      maxLength: 63
+                  anyOf:
+                  - required:
+                    - name
+                  - properties:
+                      selector:
+                        properties:
+                          app:
+                            minLength: 1
+  scope: Namespaced
+  names:
+    plural: crontabs
+    singular: crontab
+    kind: CronTab
+`)
+
+const expectedJSONSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["apiVersion", "kind"],
+  "additionalProperties": false,
+  "properties": {
+    "apiVersion": {"type": "string", "enum": ["example.com/v1"]},
+    "kind": {"type": "string", "enum": ["CronTab"]},
+    "metadata": {"type": "object"},
+    "spec": {
+      "type": "object",
+      "required": ["schedule"],
+      "additionalProperties": false,
+      "properties": {
+        "schedule": {"type": "string"},
+        "port": {"type": ["integer", "string"]},
+        "policy": {"type": ["string", "null"], "enum": ["Allow", "Forbid", null]},
+        "replicas": {"type": "integer", "exclusiveMaximum": 10},
+        "config": {
+          "type": "object",
+          "properties": {
+            "name": {"type": "string"}
+          }
+        },
+        "target": {
+          "type": "object",
+          "properties": {
+            "kind": {"type": "string"},
+            "name": {"type": "string"},
+            "selector": {
+              "type": "object",
+              "additionalProperties": false,
+              "properties": {
+                "app": {"type": "string"}
+              }
+            }
+          },
+          "allOf": [{
+            "properties": {
+              "name": {"maxLength": 63}
+            },
+            "anyOf": [
+              {"required": ["name"]},
+              {
+                "properties": {
+                  "selector": {
+                    "properties": {
+                      "app": {"minLength": 1}
+                    }
+                  }
+                }
+              }
+            ]
+          }]
+        }
+      }
+    }
+  }
+}`
+
+func TestJSONSchema(t *testing.T) {
+	c, err := NewCRDer(jsonschemacrd)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	if _, err := c.JSONSchema("v2", false); err == nil {
+		t.Error("Expected error for unknown version")
+	}
+	s, err := c.JSONSchema("v1", true)
+	if err != nil {
+		t.Fatalf("Failed to convert schema: %s", err)
+	}
+	// Compare the JSON forms to ignore differences in numeric types.
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("Failed to marshal schema: %s", err)
+	}
+	var got, expected interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Failed to unmarshal schema: %s", err)
+	}
+	if err := json.Unmarshal([]byte(expectedJSONSchema), &expected); err != nil {
+		t.Fatalf("Failed to unmarshal expected schema: %s", err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected JSON Schema:\n%s\ngot:\n%s", expectedJSONSchema, b)
+	}
+}
@@ -0,0 +1,301 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/validation"
+)
+
+// A Finding is a single problem found by a lint rule. Version is empty if the
+// problem applies to all versions of the CRD. Path is the dotted path of the
+// schema field, as used by Diff, for problems with a field of a version's
+// schema, or of the CRD field otherwise.
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Version  string   `json:"version,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Message  string   `json:"message"`
+}
+
+// A LintRule checks a CRD for a single kind of problem. Check returns the
+// problems found; their Rule and Severity are set by Lint.
+type LintRule struct {
+	Name        string
+	Description string
+	Severity    Severity
+	Check       func(crd *apiextensions.CustomResourceDefinition) []Finding
+}
+
+// LintRules are the rules that Lint applies by default.
+var LintRules = []LintRule{
+	{
+		Name:        "field-description",
+		Description: "Fields should have a description.",
+		Severity:    SeverityInfo,
+		Check:       checkFieldDescriptions,
+	},
+	{
+		Name:        "preserve-unknown-fields",
+		Description: "Unknown fields should be pruned rather than preserved for the whole CRD.",
+		Severity:    SeverityWarning,
+		Check:       checkPreserveUnknownFields,
+	},
+	{
+		Name:        "status-subresource",
+		Description: "Versions should enable the status subresource.",
+		Severity:    SeverityInfo,
+		Check:       checkStatusSubresource,
+	},
+	{
+		Name:        "printer-columns",
+		Description: "Versions should define additional printer columns.",
+		Severity:    SeverityInfo,
+		Check:       checkPrinterColumns,
+	},
+	{
+		Name:        "v1beta1-only",
+		Description: "CRDs should be valid as apiextensions.k8s.io/v1.",
+		Severity:    SeverityWarning,
+		Check:       checkV1,
+	},
+	{
+		Name:        "unbounded-string",
+		Description: "String fields should have a maxLength, pattern, format or enum.",
+		Severity:    SeverityInfo,
+		Check:       checkUnboundedStrings,
+	},
+	{
+		Name:        "unbounded-array",
+		Description: "Array fields should have a maxItems.",
+		Severity:    SeverityInfo,
+		Check:       checkUnboundedArrays,
+	},
+	{
+		Name:        "structural-schema",
+		Description: "Schemas should be structural.",
+		Severity:    SeverityWarning,
+		Check:       checkStructural,
+	},
+}
+
+// severityPenalty is the amount a rule of each severity deducts from a score.
+var severityPenalty = map[Severity]int{
+	SeverityInfo:     5,
+	SeverityWarning:  15,
+	SeverityBreaking: 30,
+}
+
+// Lint checks crd against rules, or against LintRules if none are given, and
+// returns the problems found in the order of the rules.
+func Lint(crd *apiextensions.CustomResourceDefinition, rules ...LintRule) []Finding {
+	if len(rules) == 0 {
+		rules = LintRules
+	}
+	findings := []Finding{}
+	for _, r := range rules {
+		for _, f := range r.Check(crd) {
+			f.Rule = r.Name
+			f.Severity = r.Severity
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// Score returns a score between 0 and 100 for a CRD with the given findings.
+// Each rule that was broken deducts from the score according to its severity,
+// regardless of how many times it was broken.
+func Score(findings []Finding) int {
+	score := 100
+	seen := map[string]bool{}
+	for _, f := range findings {
+		if seen[f.Rule] {
+			continue
+		}
+		seen[f.Rule] = true
+		score -= severityPenalty[f.Severity]
+	}
+	if score < 0 {
+		return 0
+	}
+	return score
+}
+
+// versionSchema is the schema of a version of a CRD. name is empty if the
+// schema is shared by all versions.
+type versionSchema struct {
+	name   string
+	schema *apiextensions.JSONSchemaProps
+}
+
+func versionSchemas(crd *apiextensions.CustomResourceDefinition) []versionSchema {
+	if v := crd.Spec.Validation; v != nil {
+		if v.OpenAPIV3Schema == nil {
+			return nil
+		}
+		return []versionSchema{{schema: v.OpenAPIV3Schema}}
+	}
+	var schemas []versionSchema
+	for _, v := range crd.Spec.Versions {
+		if v.Schema != nil && v.Schema.OpenAPIV3Schema != nil {
+			schemas = append(schemas, versionSchema{name: v.Name, schema: v.Schema.OpenAPIV3Schema})
+		}
+	}
+	return schemas
+}
+
+// walkSchema calls fn for each property, array item and additionalProperties
+// schema below s. property is true for named properties. Fields of the object
+// metadata at the root of a schema are skipped.
+func walkSchema(path string, s *apiextensions.JSONSchemaProps, fn func(path string, s *apiextensions.JSONSchemaProps, property bool)) {
+	if s == nil {
+		return
+	}
+	for name, prop := range s.Properties {
+		if path == "" && metaFields[name] {
+			continue
+		}
+		prop := prop
+		p := pathTo(path, name)
+		fn(p, &prop, true)
+		walkSchema(p, &prop, fn)
+	}
+	if s.Items != nil && s.Items.Schema != nil {
+		fn(path+"[]", s.Items.Schema, false)
+		walkSchema(path+"[]", s.Items.Schema, fn)
+	}
+	if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+		p := pathTo(path, "*")
+		fn(p, s.AdditionalProperties.Schema, false)
+		walkSchema(p, s.AdditionalProperties.Schema, fn)
+	}
+}
+
+// checkFields returns a finding with message for each field of each version
+// schema for which match returns true.
+func checkFields(crd *apiextensions.CustomResourceDefinition, message string, match func(s *apiextensions.JSONSchemaProps, property bool) bool) []Finding {
+	var findings []Finding
+	for _, vs := range versionSchemas(crd) {
+		var vf []Finding
+		walkSchema("", vs.schema, func(path string, s *apiextensions.JSONSchemaProps, property bool) {
+			if match(s, property) {
+				vf = append(vf, Finding{Version: vs.name, Path: path, Message: message})
+			}
+		})
+		sort.Slice(vf, func(i, j int) bool {
+			return vf[i].Path < vf[j].Path
+		})
+		findings = append(findings, vf...)
+	}
+	return findings
+}
+
+func checkFieldDescriptions(crd *apiextensions.CustomResourceDefinition) []Finding {
+	return checkFields(crd, "field has no description", func(s *apiextensions.JSONSchemaProps, property bool) bool {
+		return property && strings.TrimSpace(s.Description) == ""
+	})
+}
+
+func checkUnboundedStrings(crd *apiextensions.CustomResourceDefinition) []Finding {
+	return checkFields(crd, "string has no maxLength, pattern, format or enum", func(s *apiextensions.JSONSchemaProps, _ bool) bool {
+		return s.Type == "string" && s.MaxLength == nil && s.Pattern == "" && s.Format == "" && len(s.Enum) == 0
+	})
+}
+
+func checkUnboundedArrays(crd *apiextensions.CustomResourceDefinition) []Finding {
+	return checkFields(crd, "array has no maxItems", func(s *apiextensions.JSONSchemaProps, _ bool) bool {
+		return s.Type == "array" && s.MaxItems == nil
+	})
+}
+
+func checkPreserveUnknownFields(crd *apiextensions.CustomResourceDefinition) []Finding {
+	if crd.Spec.PreserveUnknownFields != nil && *crd.Spec.PreserveUnknownFields {
+		return []Finding{{Path: "spec.preserveUnknownFields", Message: "unknown fields are preserved for the whole CRD"}}
+	}
+	return nil
+}
+
+func checkStatusSubresource(crd *apiextensions.CustomResourceDefinition) []Finding {
+	hasStatus := func(s *apiextensions.CustomResourceSubresources) bool {
+		return s != nil && s.Status != nil
+	}
+	if crd.Spec.Subresources != nil || len(crd.Spec.Versions) == 0 {
+		if hasStatus(crd.Spec.Subresources) {
+			return nil
+		}
+		return []Finding{{Message: "status subresource is not enabled"}}
+	}
+	var findings []Finding
+	for _, v := range crd.Spec.Versions {
+		if !hasStatus(v.Subresources) {
+			findings = append(findings, Finding{Version: v.Name, Message: "status subresource is not enabled"})
+		}
+	}
+	return findings
+}
+
+func checkPrinterColumns(crd *apiextensions.CustomResourceDefinition) []Finding {
+	if len(crd.Spec.AdditionalPrinterColumns) > 0 || len(crd.Spec.Versions) == 0 {
+		return nil
+	}
+	var findings []Finding
+	for _, v := range crd.Spec.Versions {
+		if len(v.AdditionalPrinterColumns) == 0 {
+			findings = append(findings, Finding{Version: v.Name, Message: "no additional printer columns are defined"})
+		}
+	}
+	return findings
+}
+
+func checkV1(crd *apiextensions.CustomResourceDefinition) []Finding {
+	var findings []Finding
+	for _, err := range validation.ValidateCustomResourceDefinition(withoutWebhook(crd), v1.SchemeGroupVersion) {
+		// Labels and annotations may have been stripped when the CRD was
+		// indexed, and the client config of a conversion webhook redacted,
+		// so problems with them are not reported.
+		if strings.HasPrefix(err.Field, "metadata.") {
+			continue
+		}
+		findings = append(findings, Finding{
+			Path:    err.Field,
+			Message: fmt.Sprintf("not valid as %s: %s", v1.SchemeGroupVersion, err.ErrorBody()),
+		})
+	}
+	return findings
+}
+
+func checkStructural(crd *apiextensions.CustomResourceDefinition) []Finding {
+	var findings []Finding
+	for _, vs := range versionSchemas(crd) {
+		errs, err := structuralErrors(vs.schema, nil)
+		if err != nil {
+			findings = append(findings, Finding{Version: vs.name, Message: err.Error()})
+			continue
+		}
+		for _, err := range errs {
+			findings = append(findings, Finding{Version: vs.name, Path: err.Field, Message: err.ErrorBody()})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"reflect"
+	"testing"
+)
+
+var lintcrd = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    subresources:
+      status: {}
+    additionalPrinterColumns:
+    - name: Schedule
+      type: string
+      jsonPath: .spec.schedule
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            description: Spec of the CronTab.
+            type: object
+            properties:
+              schedule:
+                description: Schedule in cron format.
+                type: string
+                pattern: '^(\S+ ){4}\S+$'
+              args:
+                type: array
+                items:
+                  type: string
+  scope: Namespaced
+  names:
+    plural: crontabs
+    singular: crontab
+    kind: CronTab
+`)
+
+var lintv1beta1crd = []byte(`
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  version: v1
+  scope: Namespaced
+  names:
+    plural: crontabs
+    singular: crontab
+    kind: CronTab
+`)
+
+// lintwebhookcrd is lintcrd with a conversion webhook.
+var lintwebhookcrd = append(append([]byte{}, lintcrd...), `  conversion:
+    strategy: Webhook
+    webhook:
+      conversionReviewVersions:
+      - v1
+      clientConfig:
+        url: https://example.com/convert
+`...)
+
+func TestLint(t *testing.T) {
+	cases := []struct {
+		name          string
+		crd           []byte
+		mods          []Modifier
+		expectedRules []string
+		expectedScore int
+	}{
+		{
+			name:          "unbounded array",
+			crd:           lintcrd,
+			expectedRules: []string{"field-description", "unbounded-string", "unbounded-array"},
+			expectedScore: 85,
+		},
+		{
+			name:          "redacted conversion webhook",
+			crd:           lintwebhookcrd,
+			mods:          []Modifier{RedactConversion()},
+			expectedRules: []string{"field-description", "unbounded-string", "unbounded-array"},
+			expectedScore: 85,
+		},
+		{
+			name:          "v1beta1 without schema",
+			crd:           lintv1beta1crd,
+			expectedRules: []string{"preserve-unknown-fields", "status-subresource", "printer-columns", "v1beta1-only"},
+			expectedScore: 60,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewCRDer(tc.crd, tc.mods...)
+			if err != nil {
+				t.Fatalf("Failed to create CRDer: %s", err)
+			}
+			findings := Lint(c.CRD)
+			rules := []string{}
+			for _, f := range findings {
+				if len(rules) == 0 || rules[len(rules)-1] != f.Rule {
+					rules = append(rules, f.Rule)
+				}
+			}
+			if !reflect.DeepEqual(rules, tc.expectedRules) {
+				t.Errorf("Expected rules %v, got findings %+v", tc.expectedRules, findings)
+			}
+			if s := Score(findings); s != tc.expectedScore {
+				t.Errorf("Expected score %d, got %d", tc.expectedScore, s)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// PrunedField is a field of a CRD instance that the apiserver drops because
+// it is not specified in the schema. Suggestion is the closest field name
+// that is specified in the schema at the same level, if any.
+type PrunedField struct {
+	Path       string
+	Suggestion string
+}
+
+var metaFields = map[string]bool{
+	"apiVersion": true,
+	"kind":       true,
+	"metadata":   true,
+}
+
+// objectMetaFields are the fields of metav1.ObjectMeta. Unknown metadata
+// fields are dropped by the apiserver even if unknown fields are preserved.
+var objectMetaFields = jsonFields(reflect.TypeOf(metav1.ObjectMeta{}))
+
+// Prune returns the fields of the CRD instance that the apiserver would
+// prune under the schema of its version, ordered by path. No fields are
+// pruned if the CRD preserves unknown fields.
+func (c *CRDer) Prune(data []byte) ([]PrunedField, error) {
+	instance, version, err := c.decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if c.CRD.Spec.PreserveUnknownFields != nil && *c.CRD.Spec.PreserveUnknownFields {
+		return nil, nil
+	}
+
+	s, err := getStructuralSchema(c.CRD.Spec, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// The root of an instance is always treated as an embedded resource.
+	root := *s
+	root.XEmbeddedResource = true
+	p := &pruner{}
+	p.prune(instance, &root, nil)
+	sort.Slice(p.pruned, func(i, j int) bool {
+		return p.pruned[i].Path < p.pruned[j].Path
+	})
+	return p.pruned, nil
+}
+
+type pruner struct {
+	pruned []PrunedField
+}
+
+func (p *pruner) add(path *field.Path, suggestion string) {
+	p.pruned = append(p.pruned, PrunedField{Path: path.String(), Suggestion: suggestion})
+}
+
+func (p *pruner) prune(x interface{}, s *structuralschema.Structural, path *field.Path) {
+	p.walk(x, s, path, s != nil && s.XPreserveUnknownFields)
+}
+
+// walk records the fields of x that are pruned under s. If preserve is set,
+// the unknown fields of x and of the items of an array x are kept, as by
+// skipPrune in the apiserver.
+func (p *pruner) walk(x interface{}, s *structuralschema.Structural, path *field.Path, preserve bool) {
+	switch x := x.(type) {
+	case map[string]interface{}:
+		for _, k := range mapKeys(x) {
+			child := path.Child(k)
+			if s != nil && s.XEmbeddedResource && metaFields[k] {
+				if k == "metadata" {
+					p.metadata(x[k], child)
+				}
+				continue
+			}
+			switch {
+			case s == nil:
+				p.add(child, "")
+			case hasProperty(s, k):
+				prop := s.Properties[k]
+				p.prune(x[k], &prop, child)
+			case s.AdditionalProperties != nil:
+				p.prune(x[k], s.AdditionalProperties.Structural, path.Key(k))
+			case preserve:
+			default:
+				p.add(child, suggest(k, s.Properties))
+			}
+		}
+	case []interface{}:
+		var items *structuralschema.Structural
+		if s != nil {
+			items = s.Items
+		}
+		for i, v := range x {
+			switch {
+			case !preserve:
+				p.prune(v, items, path.Index(i))
+			case items != nil:
+				p.walk(v, items, path.Index(i), true)
+			}
+		}
+	}
+}
+
+// metadata records the unknown fields of an embedded ObjectMeta.
+func (p *pruner) metadata(x interface{}, path *field.Path) {
+	m, ok := x.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, k := range mapKeys(m) {
+		if !objectMetaFields[k] {
+			p.add(path.Child(k), suggest(k, objectMetaFields))
+		}
+	}
+}
+
+func hasProperty(s *structuralschema.Structural, k string) bool {
+	_, ok := s.Properties[k]
+	return ok
+}
+
+// suggest returns the key of candidates that is closest to name, or an empty
+// string if none are close enough to be a likely typo.
+func suggest(name string, candidates interface{}) string {
+	v := reflect.ValueOf(candidates)
+	if v.Kind() != reflect.Map {
+		return ""
+	}
+	best, bestDist := "", -1
+	for _, key := range v.MapKeys() {
+		k := key.String()
+		if strings.EqualFold(k, name) {
+			return k
+		}
+		d := levenshtein(strings.ToLower(name), strings.ToLower(k))
+		if bestDist == -1 || d < bestDist || (d == bestDist && k < best) {
+			best, bestDist = k, d
+		}
+	}
+	max := len(name) / 3
+	if max < 2 {
+		max = 2
+	}
+	if bestDist == -1 || bestDist > max {
+		return ""
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+func mapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonFields returns the JSON field names of struct type t.
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if f.Anonymous && name == "" {
+			for k := range jsonFields(f.Type) {
+				fields[k] = true
+			}
+			continue
+		}
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
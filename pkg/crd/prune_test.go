@@ -0,0 +1,186 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"reflect"
+	"testing"
+)
+
+var prunecrd = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              schedule:
+                type: string
+              containers:
+                type: array
+                items:
+                  type: object
+                  properties:
+                    name:
+                      type: string
+                    pullPolicy:
+                      type: string
+              labels:
+                type: object
+                additionalProperties:
+                  type: object
+                  properties:
+                    value:
+                      type: string
+              config:
+                type: object
+                x-kubernetes-preserve-unknown-fields: true
+                properties:
+                  rules:
+                    type: array
+                    x-kubernetes-preserve-unknown-fields: true
+                    items:
+                      type: object
+                      properties:
+                        name:
+                          type: string
+                        match:
+                          type: object
+                          properties:
+                            path:
+                              type: string
+              template:
+                type: object
+                x-kubernetes-embedded-resource: true
+                properties:
+                  spec:
+                    type: object
+                    properties:
+                      image:
+                        type: string
+  scope: Namespaced
+  names:
+    plural: crontabs
+    singular: crontab
+    kind: CronTab
+`)
+
+var typos = []byte(`
+apiVersion: example.com/v1
+kind: CronTab
+metadata:
+  name: my-new-cron-object
+  lables:
+    app: cron
+spec:
+  schedul: "* * * * *"
+  containers:
+  - name: a
+    pullpolicy: Always
+  labels:
+    app:
+      value: cron
+      extra: true
+  config:
+    anything: goes
+    rules:
+    - name: a
+      extra: kept
+      match:
+        path: /
+        paht: pruned
+  template:
+    apiVersion: v1
+    kind: Pod
+    metadata:
+      name: pod
+    spec:
+      imag: busybox
+  unrelated: true
+status:
+  ready: true
+`)
+
+func TestPrune(t *testing.T) {
+	cases := []struct {
+		name        string
+		crd         []byte
+		instance    []byte
+		expected    []PrunedField
+		expectedErr bool
+	}{
+		{
+			name:     "unknown fields",
+			crd:      prunecrd,
+			instance: typos,
+			expected: []PrunedField{
+				{Path: "metadata.lables", Suggestion: "labels"},
+				{Path: "spec.config.rules[0].match.paht", Suggestion: "path"},
+				{Path: "spec.containers[0].pullpolicy", Suggestion: "pullPolicy"},
+				{Path: "spec.labels[app].extra"},
+				{Path: "spec.schedul", Suggestion: "schedule"},
+				{Path: "spec.template.spec.imag", Suggestion: "image"},
+				{Path: "spec.unrelated"},
+				{Path: "status"},
+			},
+		},
+		{
+			name:     "no unknown fields",
+			crd:      defaultcrd,
+			instance: c,
+		},
+		{
+			name:        "wrong gvk",
+			crd:         prunecrd,
+			instance:    b,
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewCRDer(tc.crd)
+			if err != nil {
+				t.Fatalf("Failed to create CRDer: %s", err)
+			}
+			pruned, err := c.Prune(tc.instance)
+			if err != nil {
+				if !tc.expectedErr {
+					t.Errorf("Unexpected pruning error: %s", err)
+				}
+				return
+			}
+			if tc.expectedErr {
+				t.Fatal("Expected pruning error")
+			}
+			if !reflect.DeepEqual(pruned, tc.expected) {
+				t.Errorf("Expected pruned fields:\n%v\ngot:\n%v", tc.expected, pruned)
+			}
+		})
+	}
+}
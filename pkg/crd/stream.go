@@ -0,0 +1,297 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+const (
+	crdKind = "CustomResourceDefinition"
+	// listSuffix ends the kind of lists, such as List and
+	// CustomResourceDefinitionList.
+	listSuffix = "List"
+)
+
+// separatorReg matches a line that starts a new YAML document.
+var separatorReg = regexp.MustCompile(`^---(\s.*)?$`)
+
+// A Document is a CRD read from a stream. Index is the position of the YAML
+// document or JSON object in the stream, starting at 0, and Line is the line
+// the CRD starts on. CRDs that are items of a List share the Index of the
+// List.
+type Document struct {
+	Index int
+	Line  int
+	CRDer *CRDer
+}
+
+// DocumentError is a problem with a single document of a stream.
+type DocumentError struct {
+	Index int
+	Line  int
+	Err   error
+}
+
+func (e *DocumentError) Error() string {
+	return fmt.Sprintf("document %d (line %d): %v", e.Index, e.Line, e.Err)
+}
+
+func (e *DocumentError) Unwrap() error {
+	return e.Err
+}
+
+// StreamError is returned when one or more documents of a stream could not be
+// read. It holds the problem with each of them.
+type StreamError struct {
+	Errors []*DocumentError
+}
+
+func (e *StreamError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, de := range e.Errors {
+		msgs = append(msgs, de.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ReadCRDers reads a stream of YAML documents or of JSON objects, such as
+// NDJSON, and returns a CRDer for each CRD, including the items of lists such
+// as List and CustomResourceDefinitionList. Documents that are not CRDs are
+// skipped. Documents that cannot be read do not stop the stream: the
+// CRDs that could be read are returned with a *StreamError.
+func ReadCRDers(r io.Reader, m ...Modifier) ([]*Document, error) {
+	return readCRDers(r, NewCRDer, m...)
+}
+
+// ReadLenientCRDers reads a stream like ReadCRDers, but accepts CRDs that fail
+// validation as NewLenientCRDer does.
+func ReadLenientCRDers(r io.Reader, m ...Modifier) ([]*Document, error) {
+	return readCRDers(r, NewLenientCRDer, m...)
+}
+
+// newCRDerFunc is a constructor of CRDers, such as NewCRDer.
+type newCRDerFunc func(data []byte, m ...Modifier) (*CRDer, error)
+
+func readCRDers(r io.Reader, newCRDer newCRDerFunc, m ...Modifier) ([]*Document, error) {
+	chunks, err := splitDocuments(r)
+	if err != nil {
+		return nil, err
+	}
+	docs := []*Document{}
+	var errs []*DocumentError
+	for i, c := range chunks {
+		d, e := readDocument(i, c, newCRDer, m...)
+		docs = append(docs, d...)
+		errs = append(errs, e...)
+	}
+	if len(errs) > 0 {
+		return docs, &StreamError{Errors: errs}
+	}
+	return docs, nil
+}
+
+// chunk is the text of a single document and the line it starts on.
+type chunk struct {
+	line int
+	data []byte
+}
+
+// splitDocuments splits a stream into documents. A stream that starts with {
+// is read as JSON objects and any other stream as YAML documents. The text of
+// each document is preceded by a blank line for each line before it so that
+// line numbers reported by the YAML parser refer to the stream.
+func splitDocuments(r io.Reader) ([]chunk, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return splitJSON(data), nil
+	}
+	return splitYAML(data)
+}
+
+// splitJSON splits a stream of JSON objects. If an object is malformed, the
+// rest of the stream is returned as a single document so that its error is
+// reported by the YAML parser.
+func splitJSON(data []byte) []chunk {
+	var chunks []chunk
+	d := json.NewDecoder(bytes.NewReader(data))
+	end := 0
+	for {
+		// Objects are separated only by whitespace, which the decoder skips.
+		start := len(data) - len(bytes.TrimLeft(data[end:], " \t\r\n"))
+		var raw json.RawMessage
+		err := d.Decode(&raw)
+		if err == io.EOF {
+			return chunks
+		}
+		if err != nil {
+			return append(chunks, jsonChunk(data, start, data[start:]))
+		}
+		chunks = append(chunks, jsonChunk(data, start, raw))
+		end = start + len(raw)
+	}
+}
+
+// jsonChunk returns the chunk of a JSON object at offset start in data.
+func jsonChunk(data []byte, start int, obj []byte) chunk {
+	n := bytes.Count(data[:start], []byte("\n"))
+	return chunk{line: n + 1, data: append(bytes.Repeat([]byte("\n"), n), obj...)}
+}
+
+// splitYAML splits a stream of YAML on document separators.
+func splitYAML(data []byte) ([]chunk, error) {
+	var chunks []chunk
+	cur := chunk{line: 1}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Bytes()
+		if separatorReg.Match(line) {
+			chunks = append(chunks, cur)
+			cur = chunk{line: n + 1, data: bytes.Repeat([]byte("\n"), n)}
+			continue
+		}
+		cur.data = append(cur.data, line...)
+		cur.data = append(cur.data, '\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return append(chunks, cur), nil
+}
+
+// readDocument returns the CRDs in a single document, which is empty if the
+// document is neither a CRD nor a list. Panics of the YAML parser on malformed
+// input are returned as errors, as documents may come from any repo.
+func readDocument(index int, c chunk, newCRDer newCRDerFunc, m ...Modifier) (docs []*Document, errs []*DocumentError) {
+	defer func() {
+		if r := recover(); r != nil {
+			docs, errs = nil, []*DocumentError{{Index: index, Line: c.line, Err: fmt.Errorf("panic while parsing YAML: %v", r)}}
+		}
+	}()
+	var root yaml.Node
+	if err := yaml.Unmarshal(c.data, &root); err != nil {
+		return nil, []*DocumentError{{Index: index, Line: c.line, Err: err}}
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil, nil
+	}
+	node := root.Content[0]
+	kind := kindOf(node)
+	if kind == crdKind {
+		d, err := readCRD(index, node, "", newCRDer, m...)
+		if err != nil {
+			return nil, []*DocumentError{err}
+		}
+		return []*Document{d}, nil
+	}
+	if !strings.HasSuffix(kind, listSuffix) {
+		return nil, nil
+	}
+	// The items of a CustomResourceDefinitionList returned by the API have no
+	// kind or apiVersion of their own.
+	var itemAPIVersion string
+	if kind == crdKind+listSuffix {
+		if v := mappingValue(node, "apiVersion"); v != nil && v.Kind == yaml.ScalarNode {
+			itemAPIVersion = v.Value
+		}
+	}
+	for _, item := range listItems(node) {
+		if k := kindOf(item); k != crdKind && (k != "" || itemAPIVersion == "") {
+			continue
+		}
+		d, err := readCRD(index, item, itemAPIVersion, newCRDer, m...)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		docs = append(docs, d)
+	}
+	return docs, errs
+}
+
+// readCRD reads the CRD in a mapping node. If apiVersion is set, it is used
+// as the apiVersion of a CRD without a kind.
+func readCRD(index int, node *yaml.Node, apiVersion string, newCRDer newCRDerFunc, m ...Modifier) (d *Document, de *DocumentError) {
+	fail := func(err error) *DocumentError {
+		return &DocumentError{Index: index, Line: node.Line, Err: err}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			d, de = nil, fail(fmt.Errorf("panic while reading CRD: %v", r))
+		}
+	}()
+	var obj interface{}
+	if err := node.Decode(&obj); err != nil {
+		return nil, fail(err)
+	}
+	if o, ok := obj.(map[string]interface{}); ok && apiVersion != "" && o["kind"] == nil {
+		o["kind"] = crdKind
+		if o["apiVersion"] == nil {
+			o["apiVersion"] = apiVersion
+		}
+	}
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, fail(err)
+	}
+	c, err := newCRDer(data, m...)
+	if err != nil {
+		return nil, fail(err)
+	}
+	return &Document{Index: index, Line: node.Line, CRDer: c}, nil
+}
+
+// kindOf returns the kind of the object in a mapping node.
+func kindOf(node *yaml.Node) string {
+	if v := mappingValue(node, "kind"); v != nil && v.Kind == yaml.ScalarNode {
+		return v.Value
+	}
+	return ""
+}
+
+// listItems returns the items of a list.
+func listItems(node *yaml.Node) []*yaml.Node {
+	if v := mappingValue(node, "items"); v != nil && v.Kind == yaml.SequenceNode {
+		return v.Content
+	}
+	return nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
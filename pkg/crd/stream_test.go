@@ -0,0 +1,222 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var stream = []byte(`# A namespace for the CRDs.
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: example
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+  scope: Namespaced
+  names:
+    plural: crontabs
+    kind: CronTab
+---
+kind: CustomResourceDefinition
+spec: [
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+- apiVersion: apiextensions.k8s.io/v1
+  kind: CustomResourceDefinition
+  metadata:
+    name: widgets.example.com
+  spec:
+    group: example.com
+    versions:
+    - name: v1
+      served: true
+      storage: true
+      schema:
+        openAPIV3Schema:
+          type: object
+    scope: Cluster
+    names:
+      plural: widgets
+      kind: Widget
+- apiVersion: apiextensions.k8s.io/v1
+  kind: CustomResourceDefinition
+  metadata:
+    name: gadgets.example.com
+  spec:
+    group: example.com
+    scope: Sideways
+---
+---
+{"apiVersion": "apiextensions.k8s.io/v1beta1", "kind": "CustomResourceDefinition",
+ "metadata": {"name": "gizmos.example.com"},
+ "spec": {"group": "example.com", "version": "v1", "scope": "Namespaced",
+  "names": {"plural": "gizmos", "kind": "Gizmo"}}}
+`)
+
+func TestReadCRDers(t *testing.T) {
+	docs, err := ReadCRDers(bytes.NewReader(stream))
+	type position struct {
+		index, line int
+		kind        string
+	}
+	expectedDocs := []position{
+		{1, 7, "CronTab"},
+		{3, 33, "Widget"},
+		{5, 59, "Gizmo"},
+	}
+	if len(docs) != len(expectedDocs) {
+		t.Fatalf("Expected %d CRDs, got %d", len(expectedDocs), len(docs))
+	}
+	for i, d := range docs {
+		got := position{d.Index, d.Line, d.CRDer.GVK.Kind}
+		if got != expectedDocs[i] {
+			t.Errorf("Expected CRD %d to be %+v, got %+v", i, expectedDocs[i], got)
+		}
+	}
+	var serr *StreamError
+	if !errors.As(err, &serr) {
+		t.Fatalf("Expected a StreamError, got %v", err)
+	}
+	expectedErrs := []position{
+		{2, 25, ""},
+		{3, 50, ""},
+	}
+	if len(serr.Errors) != len(expectedErrs) {
+		t.Fatalf("Expected %d document errors, got %v", len(expectedErrs), serr)
+	}
+	for i, de := range serr.Errors {
+		got := position{de.Index, de.Line, ""}
+		if got != expectedErrs[i] {
+			t.Errorf("Expected error %d at %+v, got %+v: %v", i, expectedErrs[i], got, de)
+		}
+	}
+	var cerr *ConversionError
+	if !errors.As(serr.Errors[1], &cerr) {
+		t.Errorf("Expected a ConversionError for an invalid CRD, got %v", serr.Errors[1])
+	}
+}
+
+// jsonCRD returns a CRD for kind as a single line of JSON.
+func jsonCRD(kind string) string {
+	plural := strings.ToLower(kind) + "s"
+	return fmt.Sprintf(`{"apiVersion": "apiextensions.k8s.io/v1", "kind": "CustomResourceDefinition", "metadata": {"name": "%s.example.com"}, "spec": {"group": "example.com", "versions": [{"name": "v1", "served": true, "storage": true, "schema": {"openAPIV3Schema": {"type": "object"}}}], "scope": "Namespaced", "names": {"plural": "%s", "kind": "%s"}}}`, plural, plural, kind)
+}
+
+func TestReadCRDersJSON(t *testing.T) {
+	type position struct {
+		index, line int
+		kind        string
+	}
+	cases := []struct {
+		name         string
+		input        string
+		expectedDocs []position
+		expectedErrs []position
+	}{
+		{
+			name:         "NDJSON",
+			input:        `{"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "example"}}` + "\n" + jsonCRD("CronTab") + "\n" + jsonCRD("Widget") + "\n",
+			expectedDocs: []position{{1, 2, "CronTab"}, {2, 3, "Widget"}},
+		},
+		{
+			name:         "Concatenated",
+			input:        "\n" + strings.Replace(jsonCRD("CronTab"), ", ", ",\n  ", -1) + jsonCRD("Widget"),
+			expectedDocs: []position{{0, 2, "CronTab"}, {1, 12, "Widget"}},
+		},
+		{
+			name:         "CustomResourceDefinitionList",
+			input:        `{"apiVersion": "apiextensions.k8s.io/v1", "kind": "CustomResourceDefinitionList", "items": [` + strings.Replace(jsonCRD("CronTab"), `"apiVersion": "apiextensions.k8s.io/v1", "kind": "CustomResourceDefinition", `, "", 1) + ",\n" + jsonCRD("Widget") + `]}`,
+			expectedDocs: []position{{0, 1, "CronTab"}, {0, 2, "Widget"}},
+		},
+		{
+			name:         "Malformed",
+			input:        jsonCRD("CronTab") + "\n\n" + `{"kind": "CustomResourceDefinition", "spec": [}` + "\n" + jsonCRD("Widget"),
+			expectedDocs: []position{{0, 1, "CronTab"}},
+			expectedErrs: []position{{1, 3, ""}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := ReadCRDers(strings.NewReader(tc.input))
+			var gotDocs, gotErrs []position
+			for _, d := range docs {
+				gotDocs = append(gotDocs, position{d.Index, d.Line, d.CRDer.GVK.Kind})
+			}
+			var serr *StreamError
+			if errors.As(err, &serr) {
+				for _, de := range serr.Errors {
+					gotErrs = append(gotErrs, position{de.Index, de.Line, ""})
+				}
+			} else if err != nil {
+				t.Fatalf("Expected a StreamError, got %v", err)
+			}
+			if fmt.Sprint(gotDocs) != fmt.Sprint(tc.expectedDocs) {
+				t.Errorf("Expected CRDs %+v, got %+v", tc.expectedDocs, gotDocs)
+			}
+			if fmt.Sprint(gotErrs) != fmt.Sprint(tc.expectedErrs) {
+				t.Errorf("Expected document errors %+v, got %+v: %v", tc.expectedErrs, gotErrs, err)
+			}
+		})
+	}
+}
+
+func TestReadCRDersMalformed(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+	}{
+		{name: "UnclosedFlow", input: "kind: [CustomResourceDefinition\n"},
+		// Panicked in the YAML parser (CVE-2022-28948).
+		{name: "UnknownEvent", input: "0: [:!00 \xef"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := ReadCRDers(strings.NewReader(tc.input))
+			if len(docs) != 0 {
+				t.Errorf("Expected no CRDs, got %d", len(docs))
+			}
+			var serr *StreamError
+			if !errors.As(err, &serr) || len(serr.Errors) != 1 {
+				t.Fatalf("Expected a StreamError with one document error, got %v", err)
+			}
+			if serr.Errors[0].Index != 0 || serr.Errors[0].Line != 1 {
+				t.Errorf("Expected an error in document 0 at line 1, got %+v", serr.Errors[0])
+			}
+		})
+	}
+}
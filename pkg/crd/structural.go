@@ -0,0 +1,58 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"fmt"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// NonStructural returns an error if a schema of the CRD is not structural, in
+// which case the apiserver sets the NonStructuralSchema condition of the CRD.
+// The error is a *ValidationError holding every violation, with paths in the
+// v1 form of the CRD, such as spec.versions[0].schema.openAPIV3Schema, and its
+// message is that of the condition.
+func NonStructural(crd *apiextensions.CustomResourceDefinition) error {
+	errs := field.ErrorList{}
+	for i, v := range crd.Spec.Versions {
+		sv := getVersionSchema(crd.Spec, v.Name)
+		if sv == nil || sv.OpenAPIV3Schema == nil {
+			continue
+		}
+		pth := field.NewPath("spec", "versions").Index(i).Child("schema", "openAPIV3Schema")
+		verrs, err := structuralErrors(sv.OpenAPIV3Schema, pth)
+		if err != nil {
+			errs = append(errs, field.Invalid(pth, nil, fmt.Sprintf("failed to check validation schema for version %s: %v", v.Name, err)))
+			continue
+		}
+		errs = append(errs, verrs...)
+	}
+	return newFieldListError(errs)
+}
+
+// structuralErrors returns the violations of the structural schema rules in
+// s, with paths relative to pth. An error is returned if s cannot be checked.
+func structuralErrors(s *apiextensions.JSONSchemaProps, pth *field.Path) (field.ErrorList, error) {
+	ss, err := structuralschema.NewStructural(s)
+	if err != nil {
+		return nil, err
+	}
+	return structuralschema.ValidateStructural(pth, ss), nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var nonstructuralcrd = []byte(`
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+  - name: v1beta1
+    served: true
+    storage: false
+  validation:
+    openAPIV3Schema:
+      type: object
+      properties:
+        spec:
+          properties:
+            schedule:
+              type: string
+  scope: Namespaced
+  names:
+    plural: crontabs
+    kind: CronTab
+`)
+
+func TestNonStructural(t *testing.T) {
+	c, err := NewCRDer(nonstructuralcrd)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	err = NonStructural(c.CRD)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	var fields []string
+	for _, fe := range verr.Errors {
+		fields = append(fields, fe.Field)
+	}
+	expected := []string{
+		"spec.versions[0].schema.openAPIV3Schema.properties[spec].type",
+		"spec.versions[1].schema.openAPIV3Schema.properties[spec].type",
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected violations at %v, got %v", expected, fields)
+	}
+	expectedMsg := "spec.versions[0].schema.openAPIV3Schema.properties[spec].type: Required value: must not be empty for specified object fields"
+	if verr.Errors[0].Error() != expectedMsg {
+		t.Errorf("Expected message %q, got %q", expectedMsg, verr.Errors[0].Error())
+	}
+
+	c, err = NewCRDer(v1crd)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	if err := NonStructural(c.CRD); err != nil {
+		t.Errorf("Unexpected violations for a structural schema: %s", err)
+	}
+}
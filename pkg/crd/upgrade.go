@@ -0,0 +1,222 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/validation"
+)
+
+// A Fix is a change made to a CRD by UpgradeToV1. Version and Path follow
+// the conventions of Finding.
+type Fix struct {
+	Version string `json:"version,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// UpgradeToV1 returns the CRD as an apiextensions.k8s.io/v1 CRD, changed where
+// needed to pass the validation of the apiserver for v1:
+//
+//   - A conversion webhook without a client config is replaced by the None
+//     strategy, as by WithoutRedactedWebhook.
+//   - spec.preserveUnknownFields is set to false, and unknown fields are
+//     preserved at the root of each schema instead if they were before.
+//   - Versions without a schema are given one that preserves unknown fields.
+//   - Schemas are made structural where the fix is unambiguous: missing types
+//     are inferred or the field preserves unknown values, types and other
+//     structural fields are removed from anyOf, allOf, oneOf and not, and
+//     metadata at the root only specifies name and generateName.
+//
+// Top-level schemas, subresources and printer columns are moved to each
+// version by the conversion to v1. The fixes made are returned. If the
+// upgraded CRD is still not valid, it is returned with a *ValidationError
+// holding the remaining problems.
+func UpgradeToV1(crd *apiextensions.CustomResourceDefinition) (*v1.CustomResourceDefinition, []Fix, error) {
+	c := crd.DeepCopy()
+	var fixes []Fix
+	change := func(version, path, msg string) {
+		fixes = append(fixes, Fix{Version: version, Path: path, Message: msg})
+	}
+
+	if noWebhook, ok := WithoutRedactedWebhook(c); ok {
+		c = noWebhook
+		change("", "spec.conversion.strategy", "set to None, as the client config of the conversion webhook is not published")
+	}
+	preserved := c.Spec.PreserveUnknownFields == nil || *c.Spec.PreserveUnknownFields
+	if preserved {
+		f := false
+		c.Spec.PreserveUnknownFields = &f
+		change("", "spec.preserveUnknownFields", "set to false, as required by v1")
+	}
+	if c.Spec.Validation == nil {
+		for i, v := range c.Spec.Versions {
+			if v.Schema == nil || v.Schema.OpenAPIV3Schema == nil {
+				c.Spec.Versions[i].Schema = &apiextensions.CustomResourceValidation{
+					OpenAPIV3Schema: &apiextensions.JSONSchemaProps{Type: "object"},
+				}
+				change(v.Name, "", "added a schema, as required by v1")
+			}
+		}
+	}
+
+	for _, vs := range versionSchemas(c) {
+		s := vs.schema
+		if preserved && !preservesUnknownFields(s) {
+			s.XPreserveUnknownFields = &preserved
+			change(vs.name, "", "unknown fields are preserved, as they were with spec.preserveUnknownFields")
+		}
+		if s.Type == "" {
+			s.Type = "object"
+			change(vs.name, "", "set type to object, as required at the root of a schema")
+		}
+		if m, ok := s.Properties["metadata"]; ok {
+			fixMetadata(&m, func(path, msg string) { change(vs.name, pathTo("metadata", path), msg) })
+			s.Properties["metadata"] = m
+		}
+		fixStructural("", s, func(path, msg string) { change(vs.name, path, msg) })
+	}
+
+	out := &v1.CustomResourceDefinition{}
+	if err := v1.Convert_apiextensions_CustomResourceDefinition_To_v1_CustomResourceDefinition(c, out, nil); err != nil {
+		return nil, nil, err
+	}
+	out.SetGroupVersionKind(v1.SchemeGroupVersion.WithKind("CustomResourceDefinition"))
+	// The result is validated as the apiserver validates a v1 request: after
+	// converting it back, which moves schemas that are identical in every
+	// version to the top level.
+	in := &apiextensions.CustomResourceDefinition{}
+	if err := v1.Convert_v1_CustomResourceDefinition_To_apiextensions_CustomResourceDefinition(out.DeepCopy(), in, nil); err != nil {
+		return nil, nil, err
+	}
+	return out, fixes, newFieldListError(validation.ValidateCustomResourceDefinition(in, v1.SchemeGroupVersion))
+}
+
+// fixStructural makes the schema s at path structural where it can, calling
+// change for each change made.
+func fixStructural(path string, s *apiextensions.JSONSchemaProps, change func(path, msg string)) {
+	if s.Type == "" && !s.XIntOrString && !preservesUnknownFields(s) {
+		switch {
+		case isIntOrStringAnyOf(s.AnyOf):
+			s.XIntOrString = true
+			change(path, "set x-kubernetes-int-or-string, as anyOf allows an integer or a string")
+		case len(s.Properties) > 0 || (s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil):
+			s.Type = "object"
+			change(path, "set type to object, as properties are specified")
+		case s.Items != nil:
+			s.Type = "array"
+			change(path, "set type to array, as items are specified")
+		default:
+			preserve := true
+			s.XPreserveUnknownFields = &preserve
+			change(path, "set x-kubernetes-preserve-unknown-fields, as no type is specified")
+		}
+	}
+	if len(s.Properties) > 0 && s.AdditionalProperties != nil {
+		s.AdditionalProperties = nil
+		change(path, "removed additionalProperties, as properties are specified")
+	}
+	for _, name := range unionKeys(s.Properties, nil) {
+		prop := s.Properties[name]
+		fixStructural(pathTo(path, name), &prop, change)
+		s.Properties[name] = prop
+	}
+	if s.Items != nil && s.Items.Schema != nil {
+		fixStructural(path+"[]", s.Items.Schema, change)
+	}
+	if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+		fixStructural(pathTo(path, "*"), s.AdditionalProperties.Schema, change)
+	}
+	if s.XIntOrString && isIntOrStringAnyOf(s.AnyOf) {
+		return
+	}
+	for i := range s.AllOf {
+		fixValueValidation(path, "allOf", &s.AllOf[i], change)
+	}
+	for i := range s.AnyOf {
+		fixValueValidation(path, "anyOf", &s.AnyOf[i], change)
+	}
+	for i := range s.OneOf {
+		fixValueValidation(path, "oneOf", &s.OneOf[i], change)
+	}
+	if s.Not != nil {
+		fixValueValidation(path, "not", s.Not, change)
+	}
+}
+
+// fixValueValidation removes the fields that the structural schema rules do
+// not allow in the value validations of anyOf, allOf, oneOf and not.
+func fixValueValidation(path, junctor string, s *apiextensions.JSONSchemaProps, change func(path, msg string)) {
+	removed := false
+	if s.Type != "" || s.Description != "" || s.Title != "" || s.Default != nil || s.Nullable || s.AdditionalProperties != nil ||
+		s.XPreserveUnknownFields != nil || s.XEmbeddedResource || s.XIntOrString {
+		s.Type, s.Description, s.Title, s.Default, s.Nullable, s.AdditionalProperties = "", "", "", nil, false, nil
+		s.XPreserveUnknownFields, s.XEmbeddedResource, s.XIntOrString = nil, false, false
+		removed = true
+	}
+	for _, name := range unionKeys(s.Properties, nil) {
+		prop := s.Properties[name]
+		fixValueValidation(pathTo(path, name), junctor, &prop, change)
+		s.Properties[name] = prop
+	}
+	if s.Items != nil && s.Items.Schema != nil {
+		fixValueValidation(path+"[]", junctor, s.Items.Schema, change)
+	}
+	for _, js := range [][]apiextensions.JSONSchemaProps{s.AllOf, s.AnyOf, s.OneOf} {
+		for i := range js {
+			fixValueValidation(path, junctor, &js[i], change)
+		}
+	}
+	if s.Not != nil {
+		fixValueValidation(path, junctor, s.Not, change)
+	}
+	if removed {
+		change(path, "removed type, description and other structural fields from "+junctor+", as they are not allowed there")
+	}
+}
+
+// fixMetadata removes everything from the schema of metadata at the root of a
+// schema other than name and generateName, which are all that the
+// structural schema rules allow.
+func fixMetadata(s *apiextensions.JSONSchemaProps, change func(path, msg string)) {
+	for _, name := range unionKeys(s.Properties, nil) {
+		if name != "name" && name != "generateName" {
+			delete(s.Properties, name)
+			change(name, "removed, as only name and generateName may be specified for metadata")
+		}
+	}
+	if s.Type == "" {
+		s.Type = "object"
+		change("", "set type to object")
+	}
+}
+
+func preservesUnknownFields(s *apiextensions.JSONSchemaProps) bool {
+	return s.XPreserveUnknownFields != nil && *s.XPreserveUnknownFields
+}
+
+// isIntOrStringAnyOf returns true if js allows either an integer or a
+// string, the pattern used for int-or-string fields before
+// x-kubernetes-int-or-string.
+func isIntOrStringAnyOf(js []apiextensions.JSONSchemaProps) bool {
+	if len(js) != 2 {
+		return false
+	}
+	types := map[string]bool{js[0].Type: true, js[1].Type: true}
+	return types["integer"] && types["string"]
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	"sigs.k8s.io/yaml"
+)
+
+var upgradecrd = []byte(`
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+  - name: v1beta1
+    served: true
+    storage: false
+  validation:
+    openAPIV3Schema:
+      properties:
+        metadata:
+          type: object
+          properties:
+            name:
+              type: string
+            labels:
+              type: object
+        spec:
+          properties:
+            port:
+              anyOf:
+              - type: integer
+              - type: string
+            config: {}
+            schedule:
+              type: string
+              oneOf:
+              - pattern: '^\S+$'
+                description: A cron expression.
+  scope: Namespaced
+  names:
+    plural: crontabs
+    kind: CronTab
+`)
+
+func TestUpgradeToV1(t *testing.T) {
+	c, err := NewCRDer(upgradecrd)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	out, fixes, err := UpgradeToV1(c.CRD)
+	if err != nil {
+		t.Fatalf("Upgraded CRD is not valid: %s", err)
+	}
+	expected := []Fix{
+		{Path: "spec.preserveUnknownFields", Message: "set to false, as required by v1"},
+		{Message: "unknown fields are preserved, as they were with spec.preserveUnknownFields"},
+		{Message: "set type to object, as required at the root of a schema"},
+		{Path: "metadata.labels", Message: "removed, as only name and generateName may be specified for metadata"},
+		{Path: "spec", Message: "set type to object, as properties are specified"},
+		{Path: "spec.config", Message: "set x-kubernetes-preserve-unknown-fields, as no type is specified"},
+		{Path: "spec.port", Message: "set x-kubernetes-int-or-string, as anyOf allows an integer or a string"},
+		{Path: "spec.schedule", Message: "removed type, description and other structural fields from oneOf, as they are not allowed there"},
+	}
+	if !reflect.DeepEqual(fixes, expected) {
+		t.Errorf("Expected fixes:\n%v\ngot:\n%v", expected, fixes)
+	}
+	if out.APIVersion != "apiextensions.k8s.io/v1" || len(out.Spec.Versions) != 2 {
+		t.Fatalf("Expected a v1 CRD with two versions, got %s with %d", out.APIVersion, len(out.Spec.Versions))
+	}
+	for _, v := range out.Spec.Versions {
+		if v.Schema == nil || v.Schema.OpenAPIV3Schema == nil {
+			t.Errorf("Expected version %s to have a schema", v.Name)
+		}
+	}
+	y, err := yaml.Marshal(out)
+	if err != nil {
+		t.Fatalf("Failed to marshal upgraded CRD: %s", err)
+	}
+	if err := convertV1ToInternal(y, &apiextensions.CustomResourceDefinition{}); err != nil {
+		t.Errorf("Upgraded CRD does not pass v1 validation: %s\n%s", err, y)
+	}
+}
+
+func TestUpgradeToV1WithoutSchema(t *testing.T) {
+	cases := []struct {
+		name     string
+		versions string
+	}{
+		{
+			name: "SingleVersion",
+			versions: `
+  version: v1`,
+		},
+		{
+			name: "TwoVersions",
+			versions: `
+  versions:
+  - name: v1
+    served: true
+    storage: true
+  - name: v1beta1
+    served: true
+    storage: false`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewCRDer([]byte(`
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com` + tc.versions + `
+  scope: Namespaced
+  names:
+    plural: crontabs
+    kind: CronTab
+`))
+			if err != nil {
+				t.Fatalf("Failed to create CRDer: %s", err)
+			}
+			out, _, err := UpgradeToV1(c.CRD)
+			if err != nil {
+				t.Fatalf("Upgraded CRD is not valid: %s", err)
+			}
+			for _, v := range out.Spec.Versions {
+				if v.Schema == nil || v.Schema.OpenAPIV3Schema == nil {
+					t.Errorf("Expected version %s to have a schema", v.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestUpgradeToV1RedactedWebhook(t *testing.T) {
+	cases := []struct {
+		name     string
+		preserve string
+	}{
+		{name: "Pruned", preserve: "false"},
+		{name: "PreserveUnknownFields", preserve: "true"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewCRDer([]byte(`
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  preserveUnknownFields: `+tc.preserve+`
+  versions:
+  - name: v1
+    served: true
+    storage: true
+  - name: v1beta1
+    served: true
+    storage: false
+  validation:
+    openAPIV3Schema:
+      type: object
+  conversion:
+    strategy: Webhook
+    conversionReviewVersions: ["v1"]
+    webhookClientConfig:
+      url: https://example.com/convert
+  scope: Namespaced
+  names:
+    plural: crontabs
+    kind: CronTab
+`), RedactConversion())
+			if err != nil {
+				t.Fatalf("Failed to create CRDer: %s", err)
+			}
+			out, fixes, err := UpgradeToV1(c.CRD)
+			if err != nil {
+				t.Fatalf("Upgraded CRD is not valid: %s", err)
+			}
+			if out.Spec.Conversion == nil || out.Spec.Conversion.Strategy != "None" {
+				t.Errorf("Expected the None conversion strategy, got %+v", out.Spec.Conversion)
+			}
+			if len(fixes) == 0 || fixes[0].Path != "spec.conversion.strategy" {
+				t.Errorf("Expected the conversion strategy to be fixed first, got %v", fixes)
+			}
+		})
+	}
+}
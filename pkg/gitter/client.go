@@ -0,0 +1,193 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/crdsdev/doc/pkg/models"
+)
+
+// Client submits and tracks index jobs. It is safe for concurrent use.
+type Client struct {
+	endpoint string
+	token    string
+	http     *http.Client
+}
+
+// A ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithToken authenticates requests with the shared secret token.
+func WithToken(token string) ClientOption {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to make requests, for instance to
+// configure mutual TLS.
+func WithHTTPClient(h *http.Client) ClientOption {
+	return func(c *Client) {
+		c.http = h
+	}
+}
+
+// NewClient returns a new Client for the gitter API served at endpoint, such
+// as https://gitter.example.com.
+func NewClient(endpoint string, o ...ClientOption) *Client {
+	c := &Client{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		http:     http.DefaultClient,
+	}
+	for _, opt := range o {
+		opt(c)
+	}
+	return c
+}
+
+// Submit queues repo to be indexed. If a job for repo is already queued or
+// running, that job is returned instead.
+func (c *Client) Submit(ctx context.Context, repo models.GitterRepo) (*Job, error) {
+	j := &Job{}
+	return j, c.do(ctx, http.MethodPost, "/jobs", repo, j)
+}
+
+// Get returns the job with the specified ID.
+func (c *Client) Get(ctx context.Context, id string) (*Job, error) {
+	j := &Job{}
+	return j, c.do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil, j)
+}
+
+// Cancel cancels the job with the specified ID.
+func (c *Client) Cancel(ctx context.Context, id string) (*Job, error) {
+	j := &Job{}
+	return j, c.do(ctx, http.MethodDelete, "/jobs/"+url.PathEscape(id), nil, j)
+}
+
+// List returns all queued and running jobs, as well as recently finished
+// ones.
+func (c *Client) List(ctx context.Context) ([]Job, error) {
+	jobs := []Job{}
+	return jobs, c.do(ctx, http.MethodGet, "/jobs", nil, &jobs)
+}
+
+// Watch calls fn each time the job with the specified ID changes and returns
+// the job once it has finished. A *JobError is returned if it did not
+// succeed.
+func (c *Client) Watch(ctx context.Context, id string, fn func(*Job)) (*Job, error) {
+	res, err := c.request(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id)+"/progress", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		j := &Job{}
+		if err := json.Unmarshal(scanner.Bytes(), j); err != nil {
+			return nil, err
+		}
+		if fn != nil {
+			fn(j)
+		}
+		if !j.Finished() {
+			continue
+		}
+		if j.State != JobSucceeded {
+			return j, &JobError{Job: j}
+		}
+		return j, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, into interface{}) error {
+	res, err := c.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(into)
+}
+
+func (c *Client) request(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.endpoint+APIPrefix+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+		b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+		e := errorResponse{}
+		if err := json.Unmarshal(b, &e); err != nil || e.Error == "" {
+			e.Error = strings.TrimSpace(string(b))
+		}
+		return nil, &StatusError{Code: res.StatusCode, Message: e.Error}
+	}
+	return res, nil
+}
+
+// IsRetryable returns true if err may be resolved by repeating the request,
+// such as when gitter cannot be reached or is overloaded.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var jobErr *JobError
+	if errors.As(err, &jobErr) {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= 500
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gitter implements the HTTP/JSON API that doc uses to submit and
+// track index jobs on gitter.
+package gitter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/crdsdev/doc/pkg/models"
+)
+
+// APIPrefix is the path prefix of the current version of the API.
+const APIPrefix = "/v1"
+
+// JobState is the state of an index job.
+type JobState string
+
+const (
+	// JobQueued indicates a job is waiting for a worker.
+	JobQueued JobState = "Queued"
+	// JobRunning indicates a job is being indexed.
+	JobRunning JobState = "Running"
+	// JobSucceeded indicates a job was indexed successfully.
+	JobSucceeded JobState = "Succeeded"
+	// JobFailed indicates a job could not be indexed.
+	JobFailed JobState = "Failed"
+	// JobCanceled indicates a job was canceled before it finished.
+	JobCanceled JobState = "Canceled"
+)
+
+// Job is a request to index a repo and its current status. CancelRequested
+// is set when a running job is canceled, until the server running it stops
+// it.
+type Job struct {
+	ID              string            `json:"id"`
+	Repo            models.GitterRepo `json:"repo"`
+	State           JobState          `json:"state"`
+	Progress        Progress          `json:"progress"`
+	Error           string            `json:"error,omitempty"`
+	CancelRequested bool              `json:"cancelRequested,omitempty"`
+	Created         time.Time         `json:"created"`
+	Updated         time.Time         `json:"updated"`
+}
+
+// Finished returns true if the job will not change state again.
+func (j *Job) Finished() bool {
+	return j.State == JobSucceeded || j.State == JobFailed || j.State == JobCanceled
+}
+
+// Key identifies the repo and tag that the job indexes. At most one job with
+// each key is queued or running.
+func (j *Job) Key() string {
+	return strings.ToLower(j.Repo.Org+"/"+j.Repo.Repo) + "@" + j.Repo.Tag
+}
+
+// Progress is the progress of a running job.
+type Progress struct {
+	Tag      string `json:"tag,omitempty"`
+	TagsDone int    `json:"tagsDone"`
+	Tags     int    `json:"tags"`
+	CRDs     int    `json:"crds"`
+}
+
+// JobError is returned by a client when a job finishes without succeeding.
+type JobError struct {
+	Job *Job
+}
+
+func (e *JobError) Error() string {
+	if e.Job.Error == "" {
+		return fmt.Sprintf("job %s %s", e.Job.ID, e.Job.State)
+	}
+	return fmt.Sprintf("job %s %s: %s", e.Job.ID, e.Job.State, e.Job.Error)
+}
+
+// StatusError is returned by a client when the API responds with an error.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("gitter responded with %d: %s", e.Code, e.Message)
+}
+
+// errorResponse is the body of an API error response.
+type errorResponse struct {
+	Error string `json:"error"`
+}
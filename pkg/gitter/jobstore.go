@@ -0,0 +1,127 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitter
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrJobNotFound is returned by a JobStore if there is no such job.
+var ErrJobNotFound = errors.New("job not found")
+
+// A JobStore holds the jobs of a Server. Servers that share a JobStore, such
+// as replicas behind a load balancer, serve and cancel the jobs accepted by
+// each other, and do not queue a repo that another has queued.
+type JobStore interface {
+	// CreateJob adds j, unless a job with the same Key has not finished, in
+	// which case that job is returned and created is false.
+	CreateJob(ctx context.Context, j Job) (existing Job, created bool, err error)
+	// Job returns the job with the specified ID.
+	Job(ctx context.Context, id string) (Job, error)
+	// Jobs returns the jobs that have not finished or were updated after
+	// since, oldest first.
+	Jobs(ctx context.Context, since time.Time) ([]Job, error)
+	// UpdateJob applies fn to the job with the specified ID, sets its Updated
+	// time and stores it, without interleaving with other updates to it.
+	UpdateJob(ctx context.Context, id string, fn func(*Job)) (Job, error)
+	// DeleteJob deletes the job with the specified ID.
+	DeleteJob(ctx context.Context, id string) error
+	// PruneJobs deletes the jobs that finished before time before.
+	PruneJobs(ctx context.Context, before time.Time) error
+}
+
+// memoryJobs is a JobStore that is not shared with other servers.
+type memoryJobs struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+func newMemoryJobs() *memoryJobs {
+	return &memoryJobs{jobs: map[string]Job{}}
+}
+
+func (m *memoryJobs) CreateJob(ctx context.Context, j Job) (Job, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.jobs {
+		if !existing.Finished() && existing.Key() == j.Key() {
+			return existing, false, nil
+		}
+	}
+	m.jobs[j.ID] = j
+	return j, true, nil
+}
+
+func (m *memoryJobs) Job(ctx context.Context, id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return j, nil
+}
+
+func (m *memoryJobs) Jobs(ctx context.Context, since time.Time) ([]Job, error) {
+	m.mu.Lock()
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		if !j.Finished() || j.Updated.After(since) {
+			jobs = append(jobs, j)
+		}
+	}
+	m.mu.Unlock()
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].Created.Before(jobs[k].Created)
+	})
+	return jobs, nil
+}
+
+func (m *memoryJobs) UpdateJob(ctx context.Context, id string, fn func(*Job)) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	fn(&j)
+	j.Updated = time.Now()
+	m.jobs[id] = j
+	return j, nil
+}
+
+func (m *memoryJobs) DeleteJob(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.jobs, id)
+	return nil
+}
+
+func (m *memoryJobs) PruneJobs(ctx context.Context, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, j := range m.jobs {
+		if j.Finished() && j.Updated.Before(before) {
+			delete(m.jobs, id)
+		}
+	}
+	return nil
+}
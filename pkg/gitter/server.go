@@ -0,0 +1,417 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitter
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crdsdev/doc/pkg/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultWorkers   = 4
+	defaultQueueSize = 64
+	defaultPoll      = time.Second
+	// jobRetention is how long a finished job may be queried.
+	jobRetention = time.Hour
+	// heartbeatInterval is how often a server marks the jobs it holds as
+	// alive, and checks whether those it is running were canceled through
+	// another server.
+	heartbeatInterval = 15 * time.Second
+	// abandonAfter is how long an unfinished job may go without a heartbeat
+	// before it is failed, as the server holding it has stopped.
+	abandonAfter = 4 * heartbeatInterval
+)
+
+// ErrQueueFull is returned by Submit when too many jobs are queued.
+var ErrQueueFull = errors.New("queue is full")
+
+// IndexFunc indexes repo, reporting progress as it goes. It must return
+// promptly once ctx is done.
+type IndexFunc func(ctx context.Context, repo models.GitterRepo, progress func(Progress)) error
+
+// Server runs index jobs submitted over the API or with Submit. Jobs are held
+// in a JobStore, which is in memory unless WithJobStore is given.
+type Server struct {
+	index   IndexFunc
+	token   string
+	workers int
+	queue   chan string
+	store   JobStore
+	poll    time.Duration
+	// heartbeatEvery is heartbeatInterval, unless changed by tests.
+	heartbeatEvery time.Duration
+
+	mu sync.Mutex
+	// local holds the jobs queued or running on this server, with the
+	// cancel funcs of those running.
+	local map[string]context.CancelFunc
+}
+
+// A ServerOption configures a Server.
+type ServerOption func(*Server)
+
+// WithServerToken requires that clients authenticate with the shared secret
+// token.
+func WithServerToken(token string) ServerOption {
+	return func(s *Server) {
+		s.token = token
+	}
+}
+
+// WithWorkers sets the number of jobs that are indexed concurrently.
+func WithWorkers(n int) ServerOption {
+	return func(s *Server) {
+		s.workers = n
+	}
+}
+
+// WithQueueSize sets the number of jobs that may wait for a worker.
+func WithQueueSize(n int) ServerOption {
+	return func(s *Server) {
+		s.queue = make(chan string, n)
+	}
+}
+
+// WithJobStore holds jobs in store, which may be shared by several servers.
+func WithJobStore(store JobStore) ServerOption {
+	return func(s *Server) {
+		s.store = store
+	}
+}
+
+// WithPollInterval sets how often progress streams check a job for changes.
+func WithPollInterval(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.poll = d
+	}
+}
+
+// NewServer returns a new Server that indexes jobs with index.
+func NewServer(index IndexFunc, o ...ServerOption) *Server {
+	s := &Server{
+		index:   index,
+		workers: defaultWorkers,
+		queue:   make(chan string, defaultQueueSize),
+		store:   newMemoryJobs(),
+		poll:    defaultPoll,
+		local:   map[string]context.CancelFunc{},
+
+		heartbeatEvery: heartbeatInterval,
+	}
+	for _, opt := range o {
+		opt(s)
+	}
+	return s
+}
+
+// Run processes jobs until ctx is done.
+func (s *Server) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case id := <-s.queue:
+					s.run(ctx, id)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	t := time.NewTicker(s.heartbeatEvery)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.heartbeat(ctx)
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+	}
+}
+
+// Handler returns the HTTP handler that serves the API.
+func (s *Server) Handler() http.Handler {
+	r := mux.NewRouter()
+	api := r.PathPrefix(APIPrefix).Subrouter()
+	api.HandleFunc("/jobs", s.submit).Methods(http.MethodPost)
+	api.HandleFunc("/jobs", s.list).Methods(http.MethodGet)
+	api.HandleFunc("/jobs/{id}", s.get).Methods(http.MethodGet)
+	api.HandleFunc("/jobs/{id}", s.cancelJob).Methods(http.MethodDelete)
+	api.HandleFunc("/jobs/{id}/progress", s.progress).Methods(http.MethodGet)
+	r.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	api.Use(s.authenticate)
+	return r
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+				writeError(w, http.StatusUnauthorized, "invalid token")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+	repo := models.GitterRepo{}
+	if err := json.NewDecoder(r.Body).Decode(&repo); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid job: "+err.Error())
+		return
+	}
+	if repo.Org == "" || repo.Repo == "" {
+		writeError(w, http.StatusBadRequest, "invalid job: org and repo are required")
+		return
+	}
+
+	j, created, err := s.Submit(r.Context(), repo)
+	switch {
+	case err != nil:
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	case created:
+		writeJSON(w, http.StatusAccepted, j)
+	default:
+		writeJSON(w, http.StatusOK, j)
+	}
+}
+
+// Submit queues a job to index repo, unless a job for it is already queued or
+// running, in which case that job is returned and created is false.
+// ErrQueueFull is returned if too many jobs are queued.
+func (s *Server) Submit(ctx context.Context, repo models.GitterRepo) (j Job, created bool, err error) {
+	now := time.Now()
+	j, created, err = s.store.CreateJob(ctx, Job{
+		ID:      uuid.New().String(),
+		Repo:    repo,
+		State:   JobQueued,
+		Created: now,
+		Updated: now,
+	})
+	if err != nil || !created {
+		return j, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case s.queue <- j.ID:
+		s.local[j.ID] = nil
+		return j, true, nil
+	default:
+		if err := s.store.DeleteJob(ctx, j.ID); err != nil {
+			return Job{}, false, err
+		}
+		return Job{}, false, ErrQueueFull
+	}
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.store.Jobs(r.Context(), time.Now().Add(-jobRetention))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	j, err := s.store.Job(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
+
+// cancelJob cancels a queued job at once. A running job is marked to be
+// canceled, and is stopped by the server running it.
+func (s *Server) cancelJob(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	j, err := s.store.UpdateJob(r.Context(), id, func(j *Job) {
+		switch j.State {
+		case JobQueued:
+			j.State = JobCanceled
+		case JobRunning:
+			j.CancelRequested = true
+		}
+	})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.mu.Lock()
+	if cancel := s.local[id]; cancel != nil {
+		cancel()
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, j)
+}
+
+// progress streams the job as newline-delimited JSON each time it changes
+// until it finishes.
+func (s *Server) progress(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	j, err := s.store.Job(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	t := time.NewTicker(s.poll)
+	defer t.Stop()
+	for {
+		if err := enc.Encode(j); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if j.Finished() {
+			return
+		}
+		for updated := j.Updated; j.Updated.Equal(updated); {
+			select {
+			case <-t.C:
+			case <-r.Context().Done():
+				return
+			}
+			if j, err = s.store.Job(r.Context(), id); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) run(ctx context.Context, id string) {
+	defer s.forget(id)
+	j, err := s.store.UpdateJob(ctx, id, func(j *Job) {
+		if j.State == JobQueued {
+			j.State = JobRunning
+		}
+	})
+	if err != nil || j.State != JobRunning {
+		return
+	}
+	jctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.mu.Lock()
+	s.local[id] = cancel
+	s.mu.Unlock()
+
+	err = s.index(jctx, j.Repo, func(p Progress) {
+		s.store.UpdateJob(ctx, id, func(j *Job) { j.Progress = p })
+	})
+
+	// The result is recorded even if the server is stopping, as no other
+	// server will.
+	s.store.UpdateJob(context.Background(), id, func(j *Job) {
+		j.CancelRequested = false
+		switch {
+		case err == nil:
+			j.State = JobSucceeded
+		case errors.Is(err, context.Canceled):
+			j.State = JobCanceled
+		default:
+			j.State = JobFailed
+			j.Error = err.Error()
+		}
+	})
+}
+
+// forget removes a job that this server no longer holds.
+func (s *Server) forget(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.local, id)
+}
+
+// heartbeat marks the jobs this server holds as alive and stops those that
+// were canceled through another server. Jobs that other servers abandoned are
+// failed, and finished jobs past jobRetention are removed.
+func (s *Server) heartbeat(ctx context.Context) {
+	s.mu.Lock()
+	local := make(map[string]context.CancelFunc, len(s.local))
+	for id, cancel := range s.local {
+		local[id] = cancel
+	}
+	s.mu.Unlock()
+	for id, cancel := range local {
+		j, err := s.store.UpdateJob(ctx, id, func(*Job) {})
+		if err == nil && j.CancelRequested && cancel != nil {
+			cancel()
+		}
+	}
+
+	now := time.Now()
+	jobs, err := s.store.Jobs(ctx, now)
+	if err != nil {
+		return
+	}
+	for _, j := range jobs {
+		if _, ok := local[j.ID]; ok || now.Sub(j.Updated) < abandonAfter {
+			continue
+		}
+		s.store.UpdateJob(ctx, j.ID, func(j *Job) {
+			if !j.Finished() && now.Sub(j.Updated) >= abandonAfter {
+				j.State = JobFailed
+				j.Error = "abandoned by the gitter server holding it"
+			}
+		})
+	}
+	s.store.PruneJobs(ctx, now.Add(-jobRetention))
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, errorResponse{Error: msg})
+}
+
+// writeStoreError writes an error returned by the JobStore.
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrJobNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/crdsdev/doc/pkg/models"
+)
+
+func TestServer(t *testing.T) {
+	block := make(chan struct{})
+	index := func(ctx context.Context, repo models.GitterRepo, progress func(Progress)) error {
+		switch repo.Repo {
+		case "fail":
+			return errors.New("clone failed")
+		case "block":
+			progress(Progress{Tag: "v0.1.0", TagsDone: 1, Tags: 2})
+			select {
+			case <-block:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+	s := NewServer(index, WithServerToken("secret"), WithPollInterval(10*time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+	c := NewClient(srv.URL, WithToken("secret"))
+
+	cases := []struct {
+		name      string
+		repo      models.GitterRepo
+		wantState JobState
+	}{
+		{
+			name:      "succeeded",
+			repo:      models.GitterRepo{Org: "crossplane", Repo: "crossplane"},
+			wantState: JobSucceeded,
+		},
+		{
+			name:      "failed",
+			repo:      models.GitterRepo{Org: "crossplane", Repo: "fail"},
+			wantState: JobFailed,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			j, err := c.Submit(ctx, tc.repo)
+			if err != nil {
+				t.Fatalf("Submit(): %s", err)
+			}
+			j, err = c.Watch(ctx, j.ID, nil)
+			if tc.wantState != JobSucceeded && err == nil {
+				t.Errorf("Watch(): expected error for state %s", tc.wantState)
+			}
+			if j.State != tc.wantState {
+				t.Errorf("Watch(): got state %s, want %s", j.State, tc.wantState)
+			}
+		})
+	}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		_, err := NewClient(srv.URL, WithToken("wrong")).List(ctx)
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.Code != http.StatusUnauthorized {
+			t.Errorf("List(): got %v, want unauthorized", err)
+		}
+		if IsRetryable(err) {
+			t.Errorf("IsRetryable(): unauthorized should not be retryable")
+		}
+	})
+
+	t.Run("deduplicate and cancel", func(t *testing.T) {
+		repo := models.GitterRepo{Org: "crossplane", Repo: "block"}
+		first, err := c.Submit(ctx, repo)
+		if err != nil {
+			t.Fatalf("Submit(): %s", err)
+		}
+		second, err := c.Submit(ctx, repo)
+		if err != nil {
+			t.Fatalf("Submit(): %s", err)
+		}
+		if first.ID != second.ID {
+			t.Errorf("Submit(): got job %s for duplicate, want %s", second.ID, first.ID)
+		}
+		running := make(chan struct{})
+		done := make(chan *Job)
+		go func() {
+			j, _ := c.Watch(ctx, first.ID, func(j *Job) {
+				if j.State == JobRunning && j.Progress.TagsDone == 1 {
+					close(running)
+				}
+			})
+			done <- j
+		}()
+		<-running
+		if _, err := c.Cancel(ctx, first.ID); err != nil {
+			t.Fatalf("Cancel(): %s", err)
+		}
+		if j := <-done; j == nil || j.State != JobCanceled {
+			t.Errorf("Watch(): got %v, want canceled job", j)
+		}
+	})
+}
+
+func TestServerSubmit(t *testing.T) {
+	// The server is not run, so jobs stay queued.
+	s := NewServer(func(ctx context.Context, repo models.GitterRepo, progress func(Progress)) error {
+		return nil
+	}, WithQueueSize(1))
+	repo := models.GitterRepo{Org: "crossplane", Repo: "crossplane"}
+	ctx := context.Background()
+	first, created, err := s.Submit(ctx, repo)
+	if err != nil || !created {
+		t.Fatalf("Submit(): got created %t, %v, want a new job", created, err)
+	}
+	again, created, err := s.Submit(ctx, models.GitterRepo{Org: "Crossplane", Repo: "Crossplane"})
+	if err != nil || created || again.ID != first.ID {
+		t.Errorf("Submit(): got %s, created %t, %v, want queued job %s", again.ID, created, err, first.ID)
+	}
+	full := models.GitterRepo{Org: "crossplane", Repo: "provider-aws"}
+	if _, _, err := s.Submit(ctx, full); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Submit(): got error %v, want ErrQueueFull", err)
+	}
+	// A job that was not queued is not kept.
+	if jobs, _ := s.store.Jobs(ctx, time.Time{}); len(jobs) != 1 {
+		t.Errorf("Jobs(): got %v, want only the queued job", jobs)
+	}
+}
+
+// TestServerSharedStore runs a job on one server and serves it through
+// another that shares its JobStore, as replicas behind a load balancer do.
+func TestServerSharedStore(t *testing.T) {
+	index := func(ctx context.Context, repo models.GitterRepo, progress func(Progress)) error {
+		progress(Progress{Tag: "v0.1.0", TagsDone: 1, Tags: 2})
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	store := newMemoryJobs()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var clients []*Client
+	for i := 0; i < 2; i++ {
+		s := NewServer(index, WithJobStore(store), WithPollInterval(10*time.Millisecond))
+		s.heartbeatEvery = 10 * time.Millisecond
+		if i == 0 {
+			go s.Run(ctx)
+		}
+		srv := httptest.NewServer(s.Handler())
+		defer srv.Close()
+		clients = append(clients, NewClient(srv.URL))
+	}
+	running, other := clients[0], clients[1]
+
+	repo := models.GitterRepo{Org: "crossplane", Repo: "crossplane"}
+	first, err := running.Submit(ctx, repo)
+	if err != nil {
+		t.Fatalf("Submit(): %s", err)
+	}
+	second, err := other.Submit(ctx, repo)
+	if err != nil {
+		t.Fatalf("Submit(): %s", err)
+	}
+	if first.ID != second.ID {
+		t.Errorf("Submit(): got job %s from the other server, want %s", second.ID, first.ID)
+	}
+	started := make(chan struct{})
+	done := make(chan *Job)
+	go func() {
+		j, _ := other.Watch(ctx, first.ID, func(j *Job) {
+			if j.State == JobRunning && j.Progress.TagsDone == 1 {
+				close(started)
+			}
+		})
+		done <- j
+	}()
+	<-started
+	if j, err := other.Cancel(ctx, first.ID); err != nil || !j.CancelRequested {
+		t.Fatalf("Cancel(): got %+v, %v, want a cancel request", j, err)
+	}
+	if j := <-done; j == nil || j.State != JobCanceled {
+		t.Errorf("Watch(): got %v, want canceled job", j)
+	}
+	if j, err := other.Get(ctx, first.ID); err != nil || j.State != JobCanceled {
+		t.Errorf("Get(): got %+v, %v, want canceled job", j, err)
+	}
+}
+
+func TestServerAbandoned(t *testing.T) {
+	store := newMemoryJobs()
+	ctx := context.Background()
+	stale := time.Now().Add(-abandonAfter)
+	for _, j := range []Job{
+		{ID: "abandoned", Repo: models.GitterRepo{Org: "org", Repo: "a"}, State: JobRunning, Updated: stale},
+		{ID: "alive", Repo: models.GitterRepo{Org: "org", Repo: "b"}, State: JobQueued, Updated: time.Now()},
+		{ID: "old", Repo: models.GitterRepo{Org: "org", Repo: "c"}, State: JobSucceeded, Updated: time.Now().Add(-2 * jobRetention)},
+	} {
+		if _, _, err := store.CreateJob(ctx, j); err != nil {
+			t.Fatalf("CreateJob(): %v", err)
+		}
+	}
+	NewServer(nil, WithJobStore(store)).heartbeat(ctx)
+	cases := []struct {
+		id      string
+		want    JobState
+		missing bool
+	}{
+		{id: "abandoned", want: JobFailed},
+		{id: "alive", want: JobQueued},
+		{id: "old", missing: true},
+	}
+	for _, tc := range cases {
+		j, err := store.Job(ctx, tc.id)
+		switch {
+		case tc.missing:
+			if !errors.Is(err, ErrJobNotFound) {
+				t.Errorf("Job(%s): got %+v, %v, want ErrJobNotFound", tc.id, j, err)
+			}
+		case err != nil || j.State != tc.want:
+			t.Errorf("Job(%s): got %+v, %v, want state %s", tc.id, j, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package migrate applies versioned migrations to the doc database.
+package migrate
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	createVersionTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);`
+
+	unknownVersionErr = "unknown schema version"
+)
+
+// A Migration changes the database schema from the previous version to
+// Version with Up, and back with Down.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// A Step is a migration applied in one direction. Revert is true if its down
+// migration is applied.
+type Step struct {
+	Migration
+	Revert bool
+}
+
+func (s Step) String() string {
+	direction := "up"
+	if s.Revert {
+		direction = "down"
+	}
+	return fmt.Sprintf("%d %s (%s)", s.Version, s.Name, direction)
+}
+
+// A Driver applies migrations to a kind of database and records its schema
+// version in the schema_migrations table.
+type Driver interface {
+	// Lock blocks until no other migrator, in this or another process, is
+	// applying migrations to the database, and keeps them from doing so
+	// until unlock is called.
+	Lock(ctx context.Context) (unlock func(), err error)
+	// Version returns the schema version of the database, which is 0 if no
+	// migrations have been applied.
+	Version(ctx context.Context) (int, error)
+	// Apply applies a step and records it in the schema_migrations table in
+	// a single transaction.
+	Apply(ctx context.Context, s Step) error
+}
+
+// Migrator migrates a database with a list of migrations.
+type Migrator struct {
+	driver     Driver
+	migrations []Migration
+}
+
+// NewMigrator returns a Migrator that applies migrations with driver.
+func NewMigrator(driver Driver, migrations []Migration) *Migrator {
+	return &Migrator{driver: driver, migrations: migrations}
+}
+
+// Latest returns the version of the last migration.
+func (m *Migrator) Latest() int {
+	return len(m.migrations)
+}
+
+// Version returns the schema version of the database, which is 0 if no
+// migrations have been applied.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	return m.driver.Version(ctx)
+}
+
+// Up applies the migrations that have not been applied to the database.
+func (m *Migrator) Up(ctx context.Context) ([]Step, error) {
+	return m.To(ctx, m.Latest())
+}
+
+// To migrates the database to version, applying up or down migrations as
+// needed, and returns the steps applied. Each step is applied in its own
+// transaction, with the database locked throughout so that concurrent calls
+// do not apply the same step twice.
+func (m *Migrator) To(ctx context.Context, version int) ([]Step, error) {
+	if err := validate(m.migrations); err != nil {
+		return nil, err
+	}
+	if version < 0 || version > m.Latest() {
+		return nil, fmt.Errorf("%s: %d", unknownVersionErr, version)
+	}
+	unlock, err := m.driver.Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	current, err := m.driver.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current > m.Latest() {
+		return nil, fmt.Errorf("%s: database is at %d, which is newer than this binary", unknownVersionErr, current)
+	}
+	var applied []Step
+	for _, s := range plan(m.migrations, current, version) {
+		if err := m.driver.Apply(ctx, s); err != nil {
+			return applied, fmt.Errorf("migration %s: %w", s, err)
+		}
+		applied = append(applied, s)
+	}
+	return applied, nil
+}
+
+// plan returns the steps that migrate a database from version from to
+// version to.
+func plan(migrations []Migration, from, to int) []Step {
+	var steps []Step
+	for v := from + 1; v <= to; v++ {
+		steps = append(steps, Step{Migration: migrations[v-1]})
+	}
+	for v := from; v > to; v-- {
+		steps = append(steps, Step{Migration: migrations[v-1], Revert: true})
+	}
+	return steps
+}
+
+// validate returns an error if migrations are not numbered from 1 without
+// gaps, or lack an up or down migration.
+func validate(migrations []Migration) error {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return fmt.Errorf("migration %q has version %d, expected %d", m.Name, m.Version, i+1)
+		}
+		if m.Up == "" || m.Down == "" {
+			return fmt.Errorf("migration %d (%s) must have up and down migrations", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// stepSQL returns the statements of a step and the statement that records
+// it in the schema_migrations table.
+func stepSQL(s Step) (string, string, []interface{}) {
+	if s.Revert {
+		return s.Down, "DELETE FROM schema_migrations WHERE version=$1;", []interface{}{s.Version}
+	}
+	return s.Up, "INSERT INTO schema_migrations(version, name) VALUES ($1, $2);", []interface{}{s.Version, s.Name}
+}
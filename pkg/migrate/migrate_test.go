@@ -0,0 +1,86 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migrate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	if err := validate(PostgresMigrations); err != nil {
+		t.Errorf("validate(PostgresMigrations): %v", err)
+	}
+	if err := validate(SQLiteMigrations); err != nil {
+		t.Errorf("validate(SQLiteMigrations): %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name       string
+		migrations []Migration
+		wantErr    bool
+	}{
+		{
+			name:       "Ordered",
+			migrations: []Migration{{Version: 1, Up: "a", Down: "b"}, {Version: 2, Up: "c", Down: "d"}},
+		},
+		{
+			name:       "Gap",
+			migrations: []Migration{{Version: 1, Up: "a", Down: "b"}, {Version: 3, Up: "c", Down: "d"}},
+			wantErr:    true,
+		},
+		{
+			name:       "NoDown",
+			migrations: []Migration{{Version: 1, Up: "a"}},
+			wantErr:    true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := validate(tc.migrations); (err != nil) != tc.wantErr {
+				t.Errorf("validate(): got error %v, want error %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	migrations := []Migration{{Version: 1, Name: "a"}, {Version: 2, Name: "b"}, {Version: 3, Name: "c"}}
+	cases := []struct {
+		name     string
+		from, to int
+		want     []string
+	}{
+		{name: "UpFromEmpty", from: 0, to: 3, want: []string{"1 a (up)", "2 b (up)", "3 c (up)"}},
+		{name: "UpPartial", from: 1, to: 2, want: []string{"2 b (up)"}},
+		{name: "Down", from: 3, to: 1, want: []string{"3 c (down)", "2 b (down)"}},
+		{name: "Current", from: 2, to: 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, s := range plan(migrations, tc.from, tc.to) {
+				got = append(got, s.String())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("plan(%d, %d): got %v, want %v", tc.from, tc.to, got, tc.want)
+			}
+		})
+	}
+}
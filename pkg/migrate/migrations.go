@@ -0,0 +1,250 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migrate
+
+// PostgresMigrations are the migrations of a Postgres doc database, in order.
+// New migrations are appended with the next version; released migrations
+// must not be changed.
+//
+// The first migrations create what schema/crds_up.sql used to, and tolerate
+// databases that were set up by hand before migrations were applied. CRD data
+// is stored once in crd_data, keyed by the SHA-256 of its JSONB text, which
+// requires Postgres 11 or later. Repos that were indexed before the repos
+// table existed are added to it without metadata and as never indexed.
+// The index jobs of gitter are kept in jobs, so that replicas of gitter share
+// them.
+var PostgresMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create tags and crds",
+		Up: `
+CREATE TABLE IF NOT EXISTS tags (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    repo VARCHAR(255) NOT NULL,
+    time TIMESTAMP NOT NULL,
+    UNIQUE(name, repo)
+);
+
+CREATE TABLE IF NOT EXISTS crds (
+    "group" VARCHAR(255) NOT NULL,
+    version VARCHAR(255) NOT NULL,
+    kind VARCHAR(255) NOT NULL,
+    tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    data JSONB NOT NULL,
+    PRIMARY KEY(tag_id, "group", version, kind)
+);
+`,
+		Down: `
+DROP TABLE IF EXISTS crds;
+DROP TABLE IF EXISTS tags;
+`,
+	},
+	{
+		Version: 2,
+		Name:    "add crds warnings",
+		Up:      `ALTER TABLE crds ADD COLUMN IF NOT EXISTS warnings JSONB;`,
+		Down:    `ALTER TABLE crds DROP COLUMN IF EXISTS warnings;`,
+	},
+	{
+		Version: 3,
+		Name:    "add crds deprecated",
+		Up:      `ALTER TABLE crds ADD COLUMN IF NOT EXISTS deprecated JSONB;`,
+		Down:    `ALTER TABLE crds DROP COLUMN IF EXISTS deprecated;`,
+	},
+	{
+		Version: 4,
+		Name:    "store crd data by hash",
+		Up: `
+CREATE TABLE crd_data (
+    hash CHAR(64) PRIMARY KEY,
+    data JSONB NOT NULL
+);
+
+INSERT INTO crd_data (hash, data)
+    SELECT DISTINCT ON (hash) hash, data FROM (SELECT encode(sha256(convert_to(data::text, 'UTF8')), 'hex') AS hash, data FROM crds) c;
+
+ALTER TABLE crds ADD COLUMN hash CHAR(64);
+UPDATE crds SET hash = encode(sha256(convert_to(data::text, 'UTF8')), 'hex');
+ALTER TABLE crds ALTER COLUMN hash SET NOT NULL;
+ALTER TABLE crds ADD FOREIGN KEY (hash) REFERENCES crd_data (hash);
+ALTER TABLE crds DROP COLUMN data;
+`,
+		Down: `
+ALTER TABLE crds ADD COLUMN data JSONB;
+UPDATE crds c SET data = d.data FROM crd_data d WHERE d.hash = c.hash;
+ALTER TABLE crds ALTER COLUMN data SET NOT NULL;
+ALTER TABLE crds DROP COLUMN hash;
+DROP TABLE crd_data;
+`,
+	},
+	{
+		Version: 5,
+		Name:    "create repos",
+		Up: `
+CREATE TABLE repos (
+    name VARCHAR(255) PRIMARY KEY,
+    host VARCHAR(255) NOT NULL,
+    default_branch VARCHAR(255) NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    license VARCHAR(255) NOT NULL DEFAULT '',
+    last_indexed TIMESTAMP,
+    last_attempted TIMESTAMP,
+    index_error TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO repos (name, host)
+    SELECT DISTINCT LOWER(repo), split_part(LOWER(repo), '/', 1) FROM tags;
+`,
+		Down: `DROP TABLE repos;`,
+	},
+	{
+		Version: 6,
+		Name:    "create jobs",
+		Up: `
+CREATE TABLE jobs (
+    id VARCHAR(36) PRIMARY KEY,
+    repo_key VARCHAR(255) NOT NULL,
+    finished BOOLEAN NOT NULL,
+    created TIMESTAMP NOT NULL,
+    updated TIMESTAMP NOT NULL,
+    data JSONB NOT NULL
+);
+
+CREATE UNIQUE INDEX jobs_unfinished_key ON jobs (repo_key) WHERE NOT finished;
+`,
+		Down: `DROP TABLE jobs;`,
+	},
+}
+
+// SQLiteMigrations are the migrations of a SQLite doc database, in order. The
+// schema matches that of PostgresMigrations, with JSON stored as text. They
+// use the sha256 and jsonb_text functions that the store registers with
+// SQLite. Columns are changed by rebuilding tables, as SQLite cannot drop them.
+var SQLiteMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create tags and crds",
+		Up: `
+CREATE TABLE tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(255) NOT NULL,
+    repo VARCHAR(255) NOT NULL,
+    time TIMESTAMP NOT NULL,
+    UNIQUE(name, repo)
+);
+
+CREATE TABLE crds (
+    "group" VARCHAR(255) NOT NULL,
+    version VARCHAR(255) NOT NULL,
+    kind VARCHAR(255) NOT NULL,
+    tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    data TEXT NOT NULL,
+    warnings TEXT,
+    deprecated TEXT,
+    PRIMARY KEY(tag_id, "group", version, kind)
+);
+`,
+		Down: `
+DROP TABLE crds;
+DROP TABLE tags;
+`,
+	},
+	{
+		Version: 2,
+		Name:    "store crd data by hash",
+		Up: `
+CREATE TABLE crd_data (
+    hash CHAR(64) PRIMARY KEY,
+    data TEXT NOT NULL
+);
+
+INSERT OR IGNORE INTO crd_data (hash, data) SELECT sha256(jsonb_text(data)), jsonb_text(data) FROM crds;
+
+CREATE TABLE crds_hashed (
+    "group" VARCHAR(255) NOT NULL,
+    version VARCHAR(255) NOT NULL,
+    kind VARCHAR(255) NOT NULL,
+    tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    hash CHAR(64) NOT NULL REFERENCES crd_data (hash),
+    warnings TEXT,
+    deprecated TEXT,
+    PRIMARY KEY(tag_id, "group", version, kind)
+);
+INSERT INTO crds_hashed SELECT "group", version, kind, tag_id, filename, sha256(jsonb_text(data)), warnings, deprecated FROM crds;
+DROP TABLE crds;
+ALTER TABLE crds_hashed RENAME TO crds;
+`,
+		Down: `
+CREATE TABLE crds_data (
+    "group" VARCHAR(255) NOT NULL,
+    version VARCHAR(255) NOT NULL,
+    kind VARCHAR(255) NOT NULL,
+    tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    data TEXT NOT NULL,
+    warnings TEXT,
+    deprecated TEXT,
+    PRIMARY KEY(tag_id, "group", version, kind)
+);
+INSERT INTO crds_data SELECT c."group", c.version, c.kind, c.tag_id, c.filename, d.data, c.warnings, c.deprecated FROM crds c INNER JOIN crd_data d ON (d.hash = c.hash);
+DROP TABLE crds;
+ALTER TABLE crds_data RENAME TO crds;
+DROP TABLE crd_data;
+`,
+	},
+	{
+		Version: 3,
+		Name:    "create repos",
+		Up: `
+CREATE TABLE repos (
+    name VARCHAR(255) PRIMARY KEY,
+    host VARCHAR(255) NOT NULL,
+    default_branch VARCHAR(255) NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    license VARCHAR(255) NOT NULL DEFAULT '',
+    last_indexed TIMESTAMP,
+    last_attempted TIMESTAMP,
+    index_error TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO repos (name, host)
+    SELECT DISTINCT LOWER(repo), substr(LOWER(repo), 1, instr(repo, '/') - 1) FROM tags;
+`,
+		Down: `DROP TABLE repos;`,
+	},
+	{
+		Version: 4,
+		Name:    "create jobs",
+		Up: `
+CREATE TABLE jobs (
+    id VARCHAR(36) PRIMARY KEY,
+    repo_key VARCHAR(255) NOT NULL,
+    finished BOOLEAN NOT NULL,
+    created TIMESTAMP NOT NULL,
+    updated TIMESTAMP NOT NULL,
+    data TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX jobs_unfinished_key ON jobs (repo_key) WHERE NOT finished;
+`,
+		Down: `DROP TABLE jobs;`,
+	},
+}
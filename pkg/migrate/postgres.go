@@ -0,0 +1,77 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migrate
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// lockID is the key of the advisory lock held while migrating Postgres, so
+// that doc and gitter instances that start together take turns.
+const lockID = 0x63726473
+
+type postgresDriver struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresDriver returns a Driver for a Postgres database. Migrations are
+// serialized with an advisory lock.
+func NewPostgresDriver(pool *pgxpool.Pool) Driver {
+	return &postgresDriver{pool: pool}
+}
+
+func (d *postgresDriver) Lock(ctx context.Context) (func(), error) {
+	conn, err := d.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		conn.Release()
+		return nil, err
+	}
+	return func() {
+		conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+		conn.Release()
+	}, nil
+}
+
+func (d *postgresDriver) Version(ctx context.Context) (int, error) {
+	if _, err := d.pool.Exec(ctx, createVersionTable); err != nil {
+		return 0, err
+	}
+	var version int
+	err := d.pool.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations;").Scan(&version)
+	return version, err
+}
+
+func (d *postgresDriver) Apply(ctx context.Context, s Step) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	sql, record, args := stepSQL(s)
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
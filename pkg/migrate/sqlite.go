@@ -0,0 +1,88 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+type sqliteDriver struct {
+	db *sql.DB
+	mu sync.Mutex
+}
+
+// NewSQLiteDriver returns a Driver for a SQLite database. Migrations are
+// serialized within the process by a mutex. Other processes are kept from
+// applying the same step by checking the schema version in the transaction
+// of each step, which SQLite serializes if the database is opened with
+// immediate transactions.
+func NewSQLiteDriver(db *sql.DB) Driver {
+	return &sqliteDriver{db: db}
+}
+
+func (d *sqliteDriver) Lock(ctx context.Context) (func(), error) {
+	d.mu.Lock()
+	return d.mu.Unlock, nil
+}
+
+func (d *sqliteDriver) Version(ctx context.Context) (int, error) {
+	if _, err := d.db.ExecContext(ctx, createVersionTable); err != nil {
+		return 0, err
+	}
+	return sqliteVersion(ctx, d.db)
+}
+
+func (d *sqliteDriver) Apply(ctx context.Context, s Step) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	current, err := sqliteVersion(ctx, tx)
+	if err != nil {
+		return err
+	}
+	want := s.Version - 1
+	if s.Revert {
+		want = s.Version
+	}
+	if current != want {
+		return fmt.Errorf("database is at %d, expected %d: migrated concurrently", current, want)
+	}
+	stmts, record, args := stepSQL(s)
+	if _, err := tx.ExecContext(ctx, stmts); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// queryRower is implemented by *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func sqliteVersion(ctx context.Context, q queryRower) (int, error) {
+	var version int
+	err := q.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations;").Scan(&version)
+	return version, err
+}
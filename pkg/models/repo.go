@@ -16,6 +16,8 @@ limitations under the License.
 
 package models
 
+import "time"
+
 // RepoCRD is a CRD and data about its location in a repository.
 type RepoCRD struct {
 	Path     string
@@ -24,11 +26,45 @@ type RepoCRD struct {
 	Version  string
 	Kind     string
 	CRD      []byte
+	// Hash is the SHA-256 of CRD as stored, in hex, which is equal for
+	// identical CRDs. It is set when a CRD is read from a store.
+	Hash string
+	// Warnings are the JSON encoded validation errors of a CRD that was
+	// indexed leniently, or nil.
+	Warnings []byte
+	// Deprecated is the JSON encoded Deprecated map of the CRDer of a CRD
+	// with deprecated versions, or nil.
+	Deprecated []byte
 }
 
 // GitterRepo is the repo for gitter to index.
 type GitterRepo struct {
-	Org  string
-	Repo string
-	Tag  string
+	Org  string `json:"org"`
+	Repo string `json:"repo"`
+	Tag  string `json:"tag,omitempty"`
+}
+
+// Repo is the metadata of an indexed repo and the record of its indexing.
+type Repo struct {
+	// Name is the canonical name of the repo, such as github.com/org/repo,
+	// in lower case.
+	Name          string
+	Host          string
+	DefaultBranch string
+	Description   string
+	// License is the SPDX identifier of the license of the repo, if known.
+	License string
+	// LastIndexed and LastAttempted are the times at which all tags of the
+	// repo were last indexed successfully and last attempted to be indexed,
+	// or zero if they never were. IndexError is the error of the last
+	// attempt, if it failed.
+	LastIndexed   time.Time
+	LastAttempted time.Time
+	IndexError    string
+}
+
+// NeedsRefresh returns true if the tags of the repo were never indexed or the
+// last attempt to index them was more than maxAge before now.
+func (r *Repo) NeedsRefresh(maxAge time.Duration, now time.Time) bool {
+	return r.LastAttempted.IsZero() || now.Sub(r.LastAttempted) > maxAge
 }
@@ -0,0 +1,337 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/crdsdev/doc/pkg/gitter"
+	"github.com/crdsdev/doc/pkg/migrate"
+	"github.com/crdsdev/doc/pkg/models"
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriver is the sqlite3 driver with a sha256 function, which returns the
+// SHA-256 of text in hex, as CRD data is stored by its hash, and a jsonb_text
+// function, which formats JSON text like Postgres formats JSONB.
+const sqliteDriver = "sqlite3_doc"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(c *sqlite3.SQLiteConn) error {
+			if err := c.RegisterFunc("sha256", sha256Hex, true); err != nil {
+				return err
+			}
+			return c.RegisterFunc("jsonb_text", sqliteJSONBText, true)
+		},
+	})
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func sqliteJSONBText(s string) (string, error) {
+	b, err := jsonbText([]byte(s))
+	return string(b), err
+}
+
+// sqliteOptions enable foreign keys, so that deleting a tag deletes its CRDs,
+// wait for other processes to release the database rather than failing, and
+// take the write lock when transactions begin, which keeps a doc and a gitter
+// process that share the database from migrating it at once.
+const sqliteOptions = "?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate"
+
+type sqlite struct {
+	db *sql.DB
+}
+
+// NewSQLite returns a Store backed by the SQLite database at path, which is
+// created if it does not exist. Building with cgo is required.
+func NewSQLite(path string) (Store, error) {
+	db, err := sql.Open(sqliteDriver, "file:"+path+sqliteOptions)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqlite{db: db}, nil
+}
+
+func (s *sqlite) Tags(ctx context.Context, repo string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT name FROM tags WHERE LOWER(repo)=LOWER($1) ORDER BY time DESC;", repo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []string{}
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+func (s *sqlite) CRDs(ctx context.Context, repo, tag string) (string, []models.RepoCRD, error) {
+	var rows *sql.Rows
+	var err error
+	if tag == "" {
+		rows, err = s.db.QueryContext(ctx, "SELECT t.name, c.\"group\", c.version, c.kind, c.filename, c.hash, d.data, c.warnings, c.deprecated FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) INNER JOIN crd_data d ON (d.hash = c.hash) WHERE LOWER(t.repo)=LOWER($1) AND t.id = (SELECT id FROM tags WHERE LOWER(repo) = LOWER($1) ORDER BY time DESC LIMIT 1);", repo)
+	} else {
+		rows, err = s.db.QueryContext(ctx, "SELECT t.name, c.\"group\", c.version, c.kind, c.filename, c.hash, d.data, c.warnings, c.deprecated FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) INNER JOIN crd_data d ON (d.hash = c.hash) WHERE LOWER(t.repo)=LOWER($1) AND t.name=$2;", repo, tag)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+	foundTag := tag
+	crds := []models.RepoCRD{}
+	for rows.Next() {
+		c := models.RepoCRD{}
+		if err := rows.Scan(&foundTag, &c.Group, &c.Version, &c.Kind, &c.Filename, &c.Hash, &c.CRD, &c.Warnings, &c.Deprecated); err != nil {
+			return "", nil, err
+		}
+		crds = append(crds, c)
+	}
+	return foundTag, crds, rows.Err()
+}
+
+func (s *sqlite) CRDHashes(ctx context.Context, repo, tag string) (string, []models.RepoCRD, error) {
+	var rows *sql.Rows
+	var err error
+	if tag == "" {
+		rows, err = s.db.QueryContext(ctx, "SELECT t.name, c.\"group\", c.version, c.kind, c.filename, c.hash FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.id = (SELECT id FROM tags WHERE LOWER(repo) = LOWER($1) ORDER BY time DESC LIMIT 1);", repo)
+	} else {
+		rows, err = s.db.QueryContext(ctx, "SELECT t.name, c.\"group\", c.version, c.kind, c.filename, c.hash FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.name=$2;", repo, tag)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+	foundTag := tag
+	crds := []models.RepoCRD{}
+	for rows.Next() {
+		c := models.RepoCRD{}
+		if err := rows.Scan(&foundTag, &c.Group, &c.Version, &c.Kind, &c.Filename, &c.Hash); err != nil {
+			return "", nil, err
+		}
+		crds = append(crds, c)
+	}
+	return foundTag, crds, rows.Err()
+}
+
+func (s *sqlite) CRD(ctx context.Context, repo, tag, group, version, kind string) (string, *models.RepoCRD, error) {
+	var r *sql.Row
+	if tag == "" {
+		r = s.db.QueryRowContext(ctx, "SELECT t.name, c.filename, c.hash, d.data, c.warnings, c.deprecated FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) INNER JOIN crd_data d ON (d.hash = c.hash) WHERE LOWER(t.repo)=LOWER($1) AND t.id = (SELECT id FROM tags WHERE LOWER(repo) = LOWER($1) ORDER BY time DESC LIMIT 1) AND c.\"group\"=$2 AND c.version=$3 AND c.kind=$4;", repo, group, version, kind)
+	} else {
+		r = s.db.QueryRowContext(ctx, "SELECT t.name, c.filename, c.hash, d.data, c.warnings, c.deprecated FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) INNER JOIN crd_data d ON (d.hash = c.hash) WHERE LOWER(t.repo)=LOWER($1) AND t.name=$2 AND c.\"group\"=$3 AND c.version=$4 AND c.kind=$5;", repo, tag, group, version, kind)
+	}
+	foundTag := tag
+	c := &models.RepoCRD{Group: group, Version: version, Kind: kind}
+	if err := r.Scan(&foundTag, &c.Filename, &c.Hash, &c.CRD, &c.Warnings, &c.Deprecated); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil, ErrNotFound
+		}
+		return "", nil, err
+	}
+	return foundTag, c, nil
+}
+
+func (s *sqlite) AddTag(ctx context.Context, repo, tag string, at time.Time, crds []models.RepoCRD) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "INSERT INTO repos(name, host) VALUES (LOWER($1), $2) ON CONFLICT DO NOTHING;", repo, repoHost(repo)); err != nil {
+		return err
+	}
+	// Times are stored in UTC so that they sort as text.
+	if _, err := tx.ExecContext(ctx, "INSERT INTO tags(name, repo, time) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING;", tag, repo, at.UTC()); err != nil {
+		return err
+	}
+	var tagID int
+	if err := tx.QueryRowContext(ctx, "SELECT id FROM tags WHERE name=$1 AND repo=$2;", tag, repo).Scan(&tagID); err != nil {
+		return err
+	}
+	for _, crd := range crds {
+		// The data is stored as Postgres stores it, so that it has the same
+		// hash in both stores.
+		data, err := jsonbText(crd.CRD)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO crd_data(hash, data) VALUES (sha256($1), $1) ON CONFLICT DO NOTHING;", string(data)); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO crds(\"group\", version, kind, tag_id, filename, hash, warnings, deprecated) VALUES ($1, $2, $3, $4, $5, sha256($6), $7, $8) ON CONFLICT DO NOTHING;", crd.Group, crd.Version, crd.Kind, tagID, crd.Filename, string(data), nullString(crd.Warnings), nullString(crd.Deprecated)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlite) Repo(ctx context.Context, name string) (*models.Repo, error) {
+	r, err := scanRepo(s.db.QueryRowContext(ctx, "SELECT "+repoColumns+" FROM repos WHERE name=LOWER($1);", name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return r, err
+}
+
+func (s *sqlite) UpdateRepo(ctx context.Context, repo models.Repo) error {
+	_, err := s.db.ExecContext(ctx, "INSERT INTO repos(name, host, default_branch, description, license) VALUES (LOWER($1), $2, $3, $4, $5) ON CONFLICT (name) DO UPDATE SET default_branch=EXCLUDED.default_branch, description=EXCLUDED.description, license=EXCLUDED.license;", repo.Name, repoHost(repo.Name), repo.DefaultBranch, repo.Description, repo.License)
+	return err
+}
+
+func (s *sqlite) RecordIndex(ctx context.Context, name string, at time.Time, indexErr string) error {
+	// SQLite numbers $ parameters in order of appearance, so ?NNN are used.
+	_, err := s.db.ExecContext(ctx, "INSERT INTO repos(name, host, last_indexed, last_attempted, index_error) VALUES (LOWER(?1), ?2, CASE WHEN ?4 = '' THEN ?3 END, ?3, ?4) ON CONFLICT (name) DO UPDATE SET last_indexed=COALESCE(EXCLUDED.last_indexed, repos.last_indexed), last_attempted=EXCLUDED.last_attempted, index_error=EXCLUDED.index_error;", name, repoHost(name), at.UTC(), indexErr)
+	return err
+}
+
+func (s *sqlite) StaleRepos(ctx context.Context, before time.Time, limit int) ([]models.Repo, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+repoColumns+" FROM repos r WHERE (last_attempted IS NULL OR last_attempted < $1) AND EXISTS (SELECT 1 FROM tags t WHERE LOWER(t.repo) = r.name) ORDER BY last_attempted NULLS FIRST LIMIT $2;", before.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	repos := []models.Repo{}
+	for rows.Next() {
+		r, err := scanRepo(rows)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, *r)
+	}
+	return repos, rows.Err()
+}
+
+func (s *sqlite) CreateJob(ctx context.Context, j gitter.Job) (gitter.Job, bool, error) {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return gitter.Job{}, false, err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return gitter.Job{}, false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "INSERT INTO jobs(id, repo_key, finished, created, updated, data) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING;", j.ID, j.Key(), j.Finished(), j.Created.UTC(), j.Updated.UTC(), string(data))
+	if err != nil {
+		return gitter.Job{}, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err != nil {
+			return gitter.Job{}, false, err
+		}
+		existing, err := scanJob(tx.QueryRowContext(ctx, "SELECT data FROM jobs WHERE repo_key=$1 AND NOT finished;", j.Key()))
+		return existing, false, err
+	}
+	return j, true, tx.Commit()
+}
+
+func (s *sqlite) Job(ctx context.Context, id string) (gitter.Job, error) {
+	j, err := scanJob(s.db.QueryRowContext(ctx, "SELECT data FROM jobs WHERE id=$1;", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return j, gitter.ErrJobNotFound
+	}
+	return j, err
+}
+
+func (s *sqlite) Jobs(ctx context.Context, since time.Time) ([]gitter.Job, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT data FROM jobs WHERE NOT finished OR updated > $1 ORDER BY created;", since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := []gitter.Job{}
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// UpdateJob relies on transactions taking the write lock when they begin, so
+// that updates to a job do not interleave.
+func (s *sqlite) UpdateJob(ctx context.Context, id string, fn func(*gitter.Job)) (gitter.Job, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return gitter.Job{}, err
+	}
+	defer tx.Rollback()
+	j, err := scanJob(tx.QueryRowContext(ctx, "SELECT data FROM jobs WHERE id=$1;", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return j, gitter.ErrJobNotFound
+	}
+	if err != nil {
+		return j, err
+	}
+	fn(&j)
+	j.Updated = time.Now()
+	data, err := json.Marshal(j)
+	if err != nil {
+		return j, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE jobs SET finished=$1, updated=$2, data=$3 WHERE id=$4;", j.Finished(), j.Updated.UTC(), string(data), id); err != nil {
+		return j, err
+	}
+	return j, tx.Commit()
+}
+
+func (s *sqlite) DeleteJob(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM jobs WHERE id=$1;", id)
+	return err
+}
+
+func (s *sqlite) PruneJobs(ctx context.Context, before time.Time) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM jobs WHERE finished AND updated < $1;", before.UTC())
+	return err
+}
+
+func (s *sqlite) Migrator() *migrate.Migrator {
+	return migrate.NewMigrator(migrate.NewSQLiteDriver(s.db), migrate.SQLiteMigrations)
+}
+
+func (s *sqlite) Close() error {
+	return s.db.Close()
+}
+
+// nullString returns JSON to be stored as text, or nil for NULL.
+func nullString(b []byte) interface{} {
+	if b == nil {
+		return nil
+	}
+	return string(b)
+}
@@ -0,0 +1,305 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crdsdev/doc/pkg/models"
+)
+
+// newTestSQLite returns a migrated SQLite store in a temporary directory, and
+// a func that removes it.
+func newTestSQLite(t *testing.T) (Store, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSQLite(filepath.Join(dir, "doc.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("NewSQLite(): %v", err)
+	}
+	cleanup := func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+	if _, err := s.Migrator().Up(context.Background()); err != nil {
+		cleanup()
+		t.Fatalf("Migrator().Up(): %v", err)
+	}
+	return s, cleanup
+}
+
+func TestSQLite(t *testing.T) {
+	ctx := context.Background()
+	s, cleanup := newTestSQLite(t)
+	defer cleanup()
+	repo := "github.com/org/repo"
+	crontab := models.RepoCRD{Group: "example.com", Version: "v1", Kind: "CronTab", Filename: "crontab.yaml", CRD: []byte(`{"spec": {}}`), Deprecated: []byte(`{"v1beta1":"deprecated"}`)}
+	widget := models.RepoCRD{Group: "example.com", Version: "v1", Kind: "Widget", Filename: "widget.yaml", CRD: []byte(`{"spec": {}}`), Warnings: []byte(`[]`)}
+	older := time.Date(2020, 1, 1, 0, 0, 0, 0, time.FixedZone("east", 5*60*60))
+	newer := time.Date(2020, 1, 1, 1, 0, 0, 0, time.UTC)
+	if err := s.AddTag(ctx, repo, "v0.2.0", newer, []models.RepoCRD{crontab, widget}); err != nil {
+		t.Fatalf("AddTag(): %v", err)
+	}
+	if err := s.AddTag(ctx, repo, "v0.1.0", older, []models.RepoCRD{crontab}); err != nil {
+		t.Fatalf("AddTag(): %v", err)
+	}
+	// Adding a tag again keeps the CRDs that were stored for it.
+	if err := s.AddTag(ctx, repo, "v0.1.0", older, []models.RepoCRD{widget}); err != nil {
+		t.Fatalf("AddTag(): %v", err)
+	}
+
+	// Both CRDs have the same data, so it is stored once.
+	hash := sha256Hex(`{"spec": {}}`)
+	storedCrontab, storedWidget := crontab, widget
+	storedCrontab.Hash, storedWidget.Hash = hash, hash
+
+	tags, err := s.Tags(ctx, "github.com/Org/Repo")
+	if err != nil {
+		t.Fatalf("Tags(): %v", err)
+	}
+	if want := []string{"v0.2.0", "v0.1.0"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("Tags(): got %v, want %v", tags, want)
+	}
+
+	cases := []struct {
+		name    string
+		tag     string
+		wantTag string
+		want    []models.RepoCRD
+	}{
+		{name: "Latest", wantTag: "v0.2.0", want: []models.RepoCRD{storedCrontab, storedWidget}},
+		{name: "Tag", tag: "v0.1.0", wantTag: "v0.1.0", want: []models.RepoCRD{storedCrontab, storedWidget}},
+		{name: "Missing", tag: "v9.9.9", wantTag: "v9.9.9", want: []models.RepoCRD{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tag, crds, err := s.CRDs(ctx, repo, tc.tag)
+			if err != nil {
+				t.Fatalf("CRDs(): %v", err)
+			}
+			if tag != tc.wantTag {
+				t.Errorf("CRDs(): got tag %q, want %q", tag, tc.wantTag)
+			}
+			if !reflect.DeepEqual(crds, tc.want) {
+				t.Errorf("CRDs(): got %+v, want %+v", crds, tc.want)
+			}
+		})
+	}
+
+	tag, hashes, err := s.CRDHashes(ctx, repo, "")
+	if err != nil {
+		t.Fatalf("CRDHashes(): %v", err)
+	}
+	wantHashes := []models.RepoCRD{
+		{Group: "example.com", Version: "v1", Kind: "CronTab", Filename: "crontab.yaml", Hash: hash},
+		{Group: "example.com", Version: "v1", Kind: "Widget", Filename: "widget.yaml", Hash: hash},
+	}
+	if tag != "v0.2.0" || !reflect.DeepEqual(hashes, wantHashes) {
+		t.Errorf("CRDHashes(): got %q %+v, want %q %+v", tag, hashes, "v0.2.0", wantHashes)
+	}
+
+	tag, crd, err := s.CRD(ctx, repo, "", "example.com", "v1", "CronTab")
+	if err != nil {
+		t.Fatalf("CRD(): %v", err)
+	}
+	if tag != "v0.2.0" || !reflect.DeepEqual(*crd, storedCrontab) {
+		t.Errorf("CRD(): got %q %+v, want %q %+v", tag, *crd, "v0.2.0", storedCrontab)
+	}
+	if _, _, err := s.CRD(ctx, repo, "v0.1.0", "example.com", "v1", "Gadget"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CRD(): got error %v, want ErrNotFound", err)
+	}
+}
+
+func TestSQLiteMigrate(t *testing.T) {
+	ctx := context.Background()
+	s, cleanup := newTestSQLite(t)
+	defer cleanup()
+	m := s.Migrator()
+	if v, err := m.Version(ctx); err != nil || v != m.Latest() {
+		t.Fatalf("Version(): got %d, %v, want %d", v, err, m.Latest())
+	}
+	steps, err := m.To(ctx, 0)
+	if err != nil {
+		t.Fatalf("To(0): %v", err)
+	}
+	if len(steps) != m.Latest() {
+		t.Errorf("To(0): applied %d steps, want %d", len(steps), m.Latest())
+	}
+	if steps, err := m.Up(ctx); err != nil || len(steps) != m.Latest() {
+		t.Errorf("Up(): applied %v, %v, want %d steps", steps, err, m.Latest())
+	}
+}
+
+func TestSQLiteRepos(t *testing.T) {
+	ctx := context.Background()
+	s, cleanup := newTestSQLite(t)
+	defer cleanup()
+	crds := []models.RepoCRD{{Group: "example.com", Version: "v1", Kind: "CronTab", Filename: "crontab.yaml", CRD: []byte(`{"spec": {}}`)}}
+	for _, repo := range []string{"github.com/org/indexed", "github.com/org/failing", "github.com/org/new"} {
+		if err := s.AddTag(ctx, repo, "v0.1.0", time.Now(), crds); err != nil {
+			t.Fatalf("AddTag(): %v", err)
+		}
+	}
+	first := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	if err := s.UpdateRepo(ctx, models.Repo{Name: "github.com/Org/Indexed", DefaultBranch: "main", Description: "CRDs", License: "Apache-2.0"}); err != nil {
+		t.Fatalf("UpdateRepo(): %v", err)
+	}
+	records := []struct {
+		repo     string
+		at       time.Time
+		indexErr string
+	}{
+		{repo: "github.com/org/indexed", at: first},
+		{repo: "github.com/org/failing", at: first},
+		{repo: "github.com/org/failing", at: second, indexErr: "clone failed"},
+		// Repos without tags are not refreshed.
+		{repo: "github.com/org/missing", at: first, indexErr: "not found"},
+	}
+	for _, r := range records {
+		if err := s.RecordIndex(ctx, r.repo, r.at, r.indexErr); err != nil {
+			t.Fatalf("RecordIndex(): %v", err)
+		}
+	}
+
+	cases := []struct {
+		name string
+		repo string
+		want *models.Repo
+	}{
+		{
+			name: "Indexed",
+			repo: "github.com/org/indexed",
+			want: &models.Repo{Name: "github.com/org/indexed", Host: "github.com", DefaultBranch: "main", Description: "CRDs", License: "Apache-2.0", LastIndexed: first, LastAttempted: first},
+		},
+		{
+			name: "Failing",
+			repo: "github.com/Org/Failing",
+			want: &models.Repo{Name: "github.com/org/failing", Host: "github.com", LastIndexed: first, LastAttempted: second, IndexError: "clone failed"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := s.Repo(ctx, tc.repo)
+			if err != nil {
+				t.Fatalf("Repo(): %v", err)
+			}
+			if !got.LastIndexed.Equal(tc.want.LastIndexed) || !got.LastAttempted.Equal(tc.want.LastAttempted) {
+				t.Errorf("Repo(): got times %v, %v, want %v, %v", got.LastIndexed, got.LastAttempted, tc.want.LastIndexed, tc.want.LastAttempted)
+			}
+			got.LastIndexed, got.LastAttempted = tc.want.LastIndexed, tc.want.LastAttempted
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Repo(): got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+	if _, err := s.Repo(ctx, "github.com/org/other"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Repo(): got error %v, want ErrNotFound", err)
+	}
+
+	stale, err := s.StaleRepos(ctx, second.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatalf("StaleRepos(): %v", err)
+	}
+	var names []string
+	for _, r := range stale {
+		names = append(names, r.Name)
+	}
+	if want := []string{"github.com/org/new", "github.com/org/indexed", "github.com/org/failing"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("StaleRepos(): got %v, want %v", names, want)
+	}
+	if stale, err := s.StaleRepos(ctx, second, 1); err != nil || len(stale) != 1 || stale[0].Name != "github.com/org/new" {
+		t.Errorf("StaleRepos(): got %+v, %v, want github.com/org/new", stale, err)
+	}
+}
+
+func TestSQLiteHash(t *testing.T) {
+	ctx := context.Background()
+	s, cleanup := newTestSQLite(t)
+	defer cleanup()
+	repo := "github.com/org/repo"
+	cases := []struct {
+		name string
+		tag  string
+		data string
+	}{
+		{name: "Escaped", tag: "v0.1.0", data: escapedCRD},
+		{name: "Reformatted", tag: "v0.2.0", data: strings.Replace(escapedCRD, ": ", ":", -1)},
+	}
+	// The hash is the one that Postgres computes.
+	want := sha256Hex(escapedCRD)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			crd := models.RepoCRD{Group: "example.com", Version: "v1", Kind: "CronTab", Filename: "crontab.yaml", CRD: []byte(tc.data)}
+			if err := s.AddTag(ctx, repo, tc.tag, time.Now(), []models.RepoCRD{crd}); err != nil {
+				t.Fatalf("AddTag(): %v", err)
+			}
+			_, got, err := s.CRD(ctx, repo, tc.tag, "example.com", "v1", "CronTab")
+			if err != nil {
+				t.Fatalf("CRD(): %v", err)
+			}
+			if got.Hash != want || string(got.CRD) != escapedCRD {
+				t.Errorf("CRD(): got %s %s, want %s %s", got.Hash, got.CRD, want, escapedCRD)
+			}
+		})
+	}
+}
+
+func TestSQLiteMigrateHash(t *testing.T) {
+	ctx := context.Background()
+	s, cleanup := newTestSQLite(t)
+	defer cleanup()
+	m := s.Migrator()
+	if _, err := m.To(ctx, 1); err != nil {
+		t.Fatalf("To(1): %v", err)
+	}
+	db := s.(*sqlite).db
+	if _, err := db.ExecContext(ctx, "INSERT INTO tags(id, name, repo, time) VALUES (1, 'v0.1.0', 'github.com/org/repo', $1);", time.Now().UTC()); err != nil {
+		t.Fatalf("INSERT INTO tags: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO crds(\"group\", version, kind, tag_id, filename, data) VALUES ('example.com', 'v1', 'CronTab', 1, 'crontab.yaml', $1);", strings.Replace(escapedCRD, ": ", ":", -1)); err != nil {
+		t.Fatalf("INSERT INTO crds: %v", err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up(): %v", err)
+	}
+	_, crds, err := s.CRDs(ctx, "github.com/org/repo", "v0.1.0")
+	if err != nil {
+		t.Fatalf("CRDs(): %v", err)
+	}
+	if want := sha256Hex(escapedCRD); len(crds) != 1 || crds[0].Hash != want || string(crds[0].CRD) != escapedCRD {
+		t.Errorf("CRDs(): got %+v, want one CRD with hash %s", crds, want)
+	}
+}
+
+func TestSQLiteJobs(t *testing.T) {
+	s, cleanup := newTestSQLite(t)
+	defer cleanup()
+	testJobStore(t, s)
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package store persists indexed repos and their CRDs.
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crdsdev/doc/pkg/gitter"
+	"github.com/crdsdev/doc/pkg/migrate"
+	"github.com/crdsdev/doc/pkg/models"
+)
+
+// ErrNotFound is returned when a CRD or repo is not in the store.
+var ErrNotFound = errors.New("not found")
+
+// Store holds the tags of indexed repos and the CRDs found at each of them.
+// Repos are named like github.com/org/repo and are matched case-insensitively.
+// The CRDs returned have no Path.
+type Store interface {
+	// Tags returns the names of the tags of a repo, newest first.
+	Tags(ctx context.Context, repo string) ([]string, error)
+	// CRDs returns the CRDs of a repo at tag, or at its newest tag if tag is
+	// empty, and the name of the tag. If there are no CRDs, the tag is
+	// returned as given.
+	CRDs(ctx context.Context, repo, tag string) (string, []models.RepoCRD, error)
+	// CRDHashes returns the CRDs of a repo at tag like CRDs, but without
+	// their data, warnings and deprecated versions. It is a cheap way to
+	// find the CRDs that changed between tags.
+	CRDHashes(ctx context.Context, repo, tag string) (string, []models.RepoCRD, error)
+	// CRD returns a single CRD of a repo at tag, or at its newest tag if tag
+	// is empty, and the name of the tag. ErrNotFound is returned if there is
+	// no such CRD.
+	CRD(ctx context.Context, repo, tag, group, version, kind string) (string, *models.RepoCRD, error)
+	// AddTag records a tag of a repo committed at time at, unless it was
+	// recorded before, and adds crds to it. CRDs already stored for the tag
+	// are kept. The data of each CRD is stored once across all tags. The
+	// repo is added if needed.
+	AddTag(ctx context.Context, repo, tag string, at time.Time, crds []models.RepoCRD) error
+	// Repo returns the metadata and index record of a repo. ErrNotFound is
+	// returned if it was never indexed.
+	Repo(ctx context.Context, name string) (*models.Repo, error)
+	// UpdateRepo stores the metadata of a repo, adding the repo if needed.
+	// Its index record is not changed.
+	UpdateRepo(ctx context.Context, repo models.Repo) error
+	// RecordIndex records an attempt at time at to index all tags of a repo,
+	// adding the repo if needed. The attempt succeeded if indexErr is empty.
+	RecordIndex(ctx context.Context, name string, at time.Time, indexErr string) error
+	// StaleRepos returns at most limit repos with tags whose last index was
+	// attempted before time before, or never, least recently attempted first.
+	StaleRepos(ctx context.Context, before time.Time, limit int) ([]models.Repo, error)
+	// The index jobs of gitter are stored so that replicas of gitter share
+	// them.
+	gitter.JobStore
+	// Migrator returns the Migrator of the schema of the store.
+	Migrator() *migrate.Migrator
+	// Close closes the store.
+	Close() error
+}
+
+// repoColumns are the columns of repos read by scanRepo.
+const repoColumns = "name, host, default_branch, description, license, last_indexed, last_attempted, index_error"
+
+// scanRepo scans the repoColumns of a row into a Repo.
+func scanRepo(row interface{ Scan(...interface{}) error }) (*models.Repo, error) {
+	r := &models.Repo{}
+	var indexed, attempted *time.Time
+	if err := row.Scan(&r.Name, &r.Host, &r.DefaultBranch, &r.Description, &r.License, &indexed, &attempted, &r.IndexError); err != nil {
+		return nil, err
+	}
+	if indexed != nil {
+		r.LastIndexed = *indexed
+	}
+	if attempted != nil {
+		r.LastAttempted = *attempted
+	}
+	return r, nil
+}
+
+// scanJob scans the data of a job stored as JSON.
+func scanJob(row interface{ Scan(...interface{}) error }) (gitter.Job, error) {
+	j := gitter.Job{}
+	var data []byte
+	if err := row.Scan(&data); err != nil {
+		return j, err
+	}
+	return j, json.Unmarshal(data, &j)
+}
+
+// repoHost returns the host of a repo named like github.com/org/repo.
+func repoHost(name string) string {
+	return strings.ToLower(strings.SplitN(name, "/", 2)[0])
+}
+
+// jsonbText formats JSON as Postgres writes the text of a JSONB value, so that
+// CRD data is hashed the same in every store and CRDs that differ only in
+// formatting are stored once. Keys are sorted by length and then bytes, the
+// last of duplicate keys is kept, and numbers are written as NUMERIC.
+func jsonbText(data []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	if d.More() {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+	b := &bytes.Buffer{}
+	if err := writeJSONB(b, v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func writeJSONB(b *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case string:
+		writeJSONBString(b, v)
+	case json.Number:
+		n, err := numericText(string(v))
+		if err != nil {
+			return err
+		}
+		b.WriteString(n)
+	case []interface{}:
+		b.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			if err := writeJSONB(b, e); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeJSONBString(b, k)
+			b.WriteString(": ")
+			if err := writeJSONB(b, v[k]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	default:
+		return fmt.Errorf("unexpected JSON value %T", v)
+	}
+	return nil
+}
+
+// writeJSONBString writes a JSON string, escaping only quotes, backslashes
+// and control characters, as Postgres does.
+func writeJSONBString(b *bytes.Buffer, s string) {
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
+
+// maxNumericExp bounds the exponent of numbers, like the range of NUMERIC.
+const maxNumericExp = 1 << 17
+
+// numericText formats a JSON number as the text of a Postgres NUMERIC, which
+// has no exponent and keeps the scale of the number, such as 1.50 for 1.50
+// and 0.015 for 1.5e-2.
+func numericText(n string) (string, error) {
+	neg := strings.HasPrefix(n, "-")
+	n = strings.TrimPrefix(n, "-")
+	exp := 0
+	if i := strings.IndexAny(n, "eE"); i >= 0 {
+		e, err := strconv.Atoi(n[i+1:])
+		if err != nil || e > maxNumericExp || e < -maxNumericExp {
+			return "", fmt.Errorf("invalid number %q", n)
+		}
+		exp, n = e, n[:i]
+	}
+	intPart, frac := n, ""
+	if i := strings.IndexByte(n, '.'); i >= 0 {
+		intPart, frac = n[:i], n[i+1:]
+	}
+	digits := intPart + frac
+	// point is the number of digits before the decimal point.
+	point := len(intPart) + exp
+	scale := len(frac) - exp
+	if scale < 0 {
+		scale = 0
+	}
+	var whole string
+	switch {
+	case point <= 0:
+		whole = ""
+	case point >= len(digits):
+		whole = digits + strings.Repeat("0", point-len(digits))
+	default:
+		whole = digits[:point]
+	}
+	whole = strings.TrimLeft(whole, "0")
+	if whole == "" {
+		whole = "0"
+	}
+	out := whole
+	if scale > 0 {
+		var fraction string
+		if point < 0 {
+			fraction = strings.Repeat("0", -point) + digits
+		} else if point < len(digits) {
+			fraction = digits[point:]
+		}
+		out += "." + fraction
+	}
+	if neg && strings.Trim(digits, "0") != "" {
+		out = "-" + out
+	}
+	return out, nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2020 The CRDS Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/crdsdev/doc/pkg/gitter"
+	"github.com/crdsdev/doc/pkg/models"
+)
+
+func TestJSONBText(t *testing.T) {
+	cases := []struct {
+		name        string
+		data        string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "Keys", data: `{"b":1,"aa":{"y":[],"x":{}},"a":2}`, expected: `{"a": 2, "b": 1, "aa": {"x": {}, "y": []}}`},
+		{name: "DuplicateKeys", data: `{"a":1,"a":2}`, expected: `{"a": 2}`},
+		{name: "Literals", data: ` [true,false,null] `, expected: `[true, false, null]`},
+		{name: "Numbers", data: `[1.50,1e2,1.5e-2,-0,-1E+3,0.0,12e-1]`, expected: `[1.50, 100, 0.015, 0, -1000, 0.0, 1.2]`},
+		{name: "Strings", data: `"<a href=\"x\">\u00e9\/\u0001\t</a>"`, expected: `"<a href=\"x\">é/\u0001\t</a>"`},
+		{name: "Invalid", data: `{"a":`, expectedErr: true},
+		{name: "TrailingData", data: `{} {}`, expectedErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := jsonbText([]byte(tc.data))
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("jsonbText(): got error %v, want error %t", err, tc.expectedErr)
+			}
+			if string(b) != tc.expected {
+				t.Errorf("jsonbText(): got %s, want %s", b, tc.expected)
+			}
+		})
+	}
+}
+
+// testJobStore checks the gitter.JobStore of a migrated store.
+func testJobStore(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now()
+	queued := gitter.Job{ID: "queued", Repo: models.GitterRepo{Org: "org", Repo: "repo", Tag: "v0.1.0"}, State: gitter.JobQueued, Created: now, Updated: now}
+	if _, created, err := s.CreateJob(ctx, queued); err != nil || !created {
+		t.Fatalf("CreateJob(): got created %t, %v, want a new job", created, err)
+	}
+	duplicate := queued
+	duplicate.ID = "duplicate"
+	duplicate.Repo.Org = "Org"
+	if j, created, err := s.CreateJob(ctx, duplicate); err != nil || created || j.ID != queued.ID {
+		t.Errorf("CreateJob(): got %+v, created %t, %v, want job %s", j, created, err, queued.ID)
+	}
+
+	j, err := s.UpdateJob(ctx, queued.ID, func(j *gitter.Job) {
+		j.State = gitter.JobFailed
+		j.Error = "clone failed"
+	})
+	if err != nil || !j.Updated.After(now) {
+		t.Fatalf("UpdateJob(): got %+v, %v, want an updated job", j, err)
+	}
+	if got, err := s.Job(ctx, queued.ID); err != nil || got.State != gitter.JobFailed || got.Error != "clone failed" {
+		t.Errorf("Job(): got %+v, %v, want a failed job", got, err)
+	}
+	// Once the job finished, the repo may be queued again.
+	if _, created, err := s.CreateJob(ctx, duplicate); err != nil || !created {
+		t.Errorf("CreateJob(): got created %t, %v, want a new job", created, err)
+	}
+
+	jobs, err := s.Jobs(ctx, now.Add(time.Hour))
+	if err != nil || len(jobs) != 1 || jobs[0].ID != duplicate.ID {
+		t.Errorf("Jobs(): got %+v, %v, want only the unfinished job", jobs, err)
+	}
+	if err := s.PruneJobs(ctx, now.Add(time.Hour)); err != nil {
+		t.Fatalf("PruneJobs(): %v", err)
+	}
+	if err := s.DeleteJob(ctx, duplicate.ID); err != nil {
+		t.Fatalf("DeleteJob(): %v", err)
+	}
+	for _, id := range []string{queued.ID, duplicate.ID} {
+		if _, err := s.Job(ctx, id); !errors.Is(err, gitter.ErrJobNotFound) {
+			t.Errorf("Job(%s): got %v, want ErrJobNotFound", id, err)
+		}
+	}
+	if _, err := s.UpdateJob(ctx, queued.ID, func(*gitter.Job) {}); !errors.Is(err, gitter.ErrJobNotFound) {
+		t.Errorf("UpdateJob(): got %v, want ErrJobNotFound", err)
+	}
+}